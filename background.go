@@ -0,0 +1,81 @@
+package httpcache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// backgroundGroup keep the keys revalidated in the background, so a single revalidation runs per key at a time
+// and the other hits of the key don't start (or wait for) another one. It's zero-value usable.
+type backgroundGroup struct {
+	mu      sync.Mutex
+	keys    map[string]context.CancelFunc
+	dropped int64
+	closed  bool
+	running sync.WaitGroup
+}
+
+// start will register the revalidation of the key, it's false when the key is already revalidating, or when
+// max (if positive) revalidations are already running, the revalidation is then dropped. Nothing starts once
+// the group is closed. The context of a started revalidation keeps the values of ctx, it's only canceled by close.
+func (g *backgroundGroup) start(ctx context.Context, key string, max int) (context.Context, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.keys[key]; ok || g.closed {
+		return nil, false
+	}
+	if max > 0 && len(g.keys) >= max {
+		g.dropped++
+		return nil, false
+	}
+	if g.keys == nil {
+		g.keys = make(map[string]context.CancelFunc)
+	}
+	ctx, cancel := context.WithCancel(detachedContext{parent: ctx})
+	g.keys[key] = cancel
+	g.running.Add(1)
+	return ctx, true
+}
+
+// done will unregister the revalidation of the key once it's completed
+func (g *backgroundGroup) done(key string) {
+	g.mu.Lock()
+	if cancel, ok := g.keys[key]; ok {
+		cancel()
+		delete(g.keys, key)
+	}
+	g.mu.Unlock()
+	g.running.Done()
+}
+
+// close will stop starting revalidations, and wait for the running ones. They are given the timeout to complete,
+// then they are canceled and waited for until they return.
+func (g *backgroundGroup) close(timeout time.Duration) {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return
+	}
+	g.closed = true
+	g.mu.Unlock()
+
+	completed := make(chan struct{})
+	go func() {
+		g.running.Wait()
+		close(completed)
+	}()
+	if timeout > 0 {
+		select {
+		case <-completed:
+			return
+		case <-time.After(timeout):
+		}
+	}
+	g.mu.Lock()
+	for _, cancel := range g.keys {
+		cancel()
+	}
+	g.mu.Unlock()
+	<-completed
+}
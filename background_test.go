@@ -0,0 +1,206 @@
+package httpcache_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/bxcodec/httpcache/cache/mirror"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxBackgroundRevalidations(t *testing.T) {
+	var hits, blocking int64
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		if atomic.LoadInt64(&blocking) == 1 {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Header()["Date"] = nil
+		w.Header().Set("Cache-Control", "max-age=60, stale-while-revalidate=600")
+		_, err := w.Write([]byte("hello"))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	clock := &fakeClock{now: time.Now()}
+	handler := httpcache.New(newInmemCache(), httpcache.WithClock(clock.Now), httpcache.WithMaxBackgroundRevalidations(3))
+	client := &http.Client{Transport: handler}
+	reqs := make([]*http.Request, 20)
+	for i := range reqs {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/%d", server.URL, i), nil)
+		require.NoError(t, err)
+		doRequest(t, client, req)
+		reqs[i] = req
+	}
+
+	// every stale key is served, only 3 of them are revalidated
+	clock.Advance(2 * time.Minute)
+	atomic.StoreInt64(&blocking, 1)
+	goroutines := runtime.NumGoroutine()
+	for _, req := range reqs {
+		resp, _ := doRequest(t, client, req)
+		require.True(t, httpcache.FromCache(resp))
+	}
+	require.Eventually(t, func() bool { return atomic.LoadInt64(&hits) == 23 }, time.Second, 10*time.Millisecond)
+	require.True(t, runtime.NumGoroutine() < goroutines+15, "%d goroutines, %d before", runtime.NumGoroutine(), goroutines)
+	require.EqualValues(t, 17, handler.Stats().DroppedRevalidations)
+
+	// a dropped key is revalidated by a later hit
+	close(release)
+	atomic.StoreInt64(&blocking, 0)
+	require.Eventually(t, func() bool {
+		doRequest(t, client, reqs[19])
+		return atomic.LoadInt64(&hits) == 24
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCloseDrainsRevalidations(t *testing.T) {
+	var hits int64
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit := atomic.AddInt64(&hits, 1)
+		if hit > 1 {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Header()["Date"] = nil
+		w.Header().Set("Cache-Control", "max-age=60, stale-while-revalidate=600")
+		_, err := fmt.Fprintf(w, "%d", hit)
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	storage := newInmemCache()
+	clock := &fakeClock{now: time.Now()}
+	newHandler := func(timeout time.Duration) (*httpcache.CacheHandler, *http.Client) {
+		handler := httpcache.New(storage, httpcache.WithClock(clock.Now))
+		handler.CloseTimeout = timeout
+		return handler, &http.Client{Transport: handler}
+	}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	handler, client := newHandler(time.Second)
+	doRequest(t, client, req)
+
+	// the running revalidation completes and is stored before Close returns
+	clock.Advance(2 * time.Minute)
+	doRequest(t, client, req)
+	require.Eventually(t, func() bool { return atomic.LoadInt64(&hits) == 2 }, time.Second, 10*time.Millisecond)
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	require.NoError(t, handler.Close())
+	_, client = newHandler(0)
+	resp, body := doRequest(t, client, req)
+	require.True(t, httpcache.FromCache(resp))
+	require.Equal(t, "2", body)
+	require.EqualValues(t, 2, atomic.LoadInt64(&hits))
+}
+
+func TestCloseCancelsRevalidations(t *testing.T) {
+	var hits int64
+	var blocking int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		if atomic.LoadInt64(&blocking) == 1 {
+			<-r.Context().Done() // never replies to the revalidations
+			return
+		}
+		w.Header()["Date"] = nil
+		w.Header().Set("Cache-Control", "max-age=60, stale-while-revalidate=600")
+		_, err := w.Write([]byte("hello"))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	clock := &fakeClock{now: time.Now()}
+	handler := httpcache.New(newInmemCache(), httpcache.WithClock(clock.Now))
+	client := &http.Client{Transport: handler}
+	reqs := make([]*http.Request, 5)
+	for i := range reqs {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/%d", server.URL, i), nil)
+		require.NoError(t, err)
+		doRequest(t, client, req)
+		reqs[i] = req
+	}
+	clock.Advance(2 * time.Minute)
+	atomic.StoreInt64(&blocking, 1)
+	goroutines := runtime.NumGoroutine()
+	for _, req := range reqs {
+		doRequest(t, client, req)
+	}
+	require.Eventually(t, func() bool { return atomic.LoadInt64(&hits) == 10 }, time.Second, 10*time.Millisecond)
+
+	// canceled right away without CloseTimeout, nothing is left running
+	closed := make(chan error)
+	go func() { closed <- handler.Close() }()
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close didn't cancel the running revalidations")
+	}
+	require.Eventually(t, func() bool { return runtime.NumGoroutine() <= goroutines }, time.Second, 10*time.Millisecond)
+
+	// and nothing starts once closed
+	doRequest(t, client, reqs[0])
+	time.Sleep(50 * time.Millisecond)
+	require.EqualValues(t, 10, atomic.LoadInt64(&hits))
+}
+
+func TestCloseLeavesNoGoroutines(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	var hits, blocking int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		if r.URL.Path == "/blocked" && atomic.LoadInt64(&blocking) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		w.Header()["Date"] = nil
+		w.Header().Set("Cache-Control", "max-age=60, stale-while-revalidate=600")
+		_, err := w.Write([]byte("hello"))
+		require.NoError(t, err)
+	}))
+	transport := &http.Transport{}
+	clock := &fakeClock{now: time.Now()}
+	// the mirror copies to its secondary in its own goroutine
+	storage := mirror.NewCache(newInmemCache(), newInmemCache())
+	handler := httpcache.New(storage, httpcache.WithTransport(transport), httpcache.WithClock(clock.Now))
+	handler.RefreshAhead = 10 * time.Second
+	client := &http.Client{Transport: handler}
+	reqs := make([]*http.Request, 0, 3)
+	for _, path := range []string{"/stale", "/refreshed", "/blocked"} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		doRequest(t, client, req)
+		reqs = append(reqs, req)
+	}
+
+	// revalidated in the background, one of them still running on Close
+	clock.Advance(55 * time.Second)
+	doRequest(t, client, reqs[1])
+	clock.Advance(2 * time.Minute)
+	atomic.StoreInt64(&blocking, 1)
+	doRequest(t, client, reqs[0])
+	doRequest(t, client, reqs[2])
+	require.Eventually(t, func() bool { return atomic.LoadInt64(&hits) == 6 }, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, handler.Close())
+	server.Close()
+	transport.CloseIdleConnections()
+	// polled without require.Eventually, it runs the condition in a goroutine of its own
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > goroutines && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.True(t, runtime.NumGoroutine() <= goroutines, "%d goroutines, %d before", runtime.NumGoroutine(), goroutines)
+}
@@ -0,0 +1,118 @@
+package httpcache
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// budgetChunkSize is the size of the reads of a body with an unknown length, reserved one at a time
+const budgetChunkSize = 32 * 1024
+
+// bufferBudget count the response bytes buffered to be stored, it's zero-value usable
+type bufferBudget struct {
+	mu       sync.Mutex
+	buffered int64
+	skipped  int64
+}
+
+func (b *bufferBudget) reserve(n, max int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.buffered+n > max {
+		return false
+	}
+	b.buffered += n
+	return true
+}
+
+func (b *bufferBudget) release(n int64) {
+	b.mu.Lock()
+	b.buffered -= n
+	b.mu.Unlock()
+}
+
+func (b *bufferBudget) skip() {
+	b.mu.Lock()
+	b.skipped++
+	b.mu.Unlock()
+}
+
+// withinBodyLimit will check if the response body is at most MaxBodyBytes. A body with an unknown length is read
+// up to the limit, and restored as it was. It's always true without limit.
+func (r *CacheHandler) withinBodyLimit(resp *http.Response) bool {
+	max := r.MaxBodyBytes
+	if max <= 0 {
+		return true
+	}
+	if resp.ContentLength >= 0 {
+		return resp.ContentLength <= max
+	}
+	var body bytes.Buffer
+	_, err := io.CopyN(&body, resp.Body, max+1)
+	if err == io.EOF {
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body.Bytes()))
+		return true
+	}
+	if err != nil {
+		r.logger().Printf("Can't read the response body to check its size, plase check. Err: %v\n", err)
+	}
+	restoreBody(resp, body.Bytes())
+	return false
+}
+
+// restoreBody will prepend the bytes already read to the body of the response, the caller reads it as it was
+// (or its failure)
+func restoreBody(resp *http.Response, read []byte) {
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(read), resp.Body), resp.Body}
+}
+
+// reserveBuffer will reserve the body size of the response in the MaxBufferedBytes budget, the release must be
+// called once the response is stored. A body with an unknown length is buffered while it's reserved, and restored
+// as it was when it doesn't fit. It's a no-op without budget.
+func (r *CacheHandler) reserveBuffer(resp *http.Response) (release func(), ok bool) {
+	max := r.MaxBufferedBytes
+	if max <= 0 {
+		return func() {}, true
+	}
+	if resp.ContentLength >= 0 {
+		if !r.budget.reserve(resp.ContentLength, max) {
+			r.budget.skip()
+			return nil, false
+		}
+		return func() { r.budget.release(resp.ContentLength) }, true
+	}
+
+	chunk := int64(budgetChunkSize)
+	if chunk > max {
+		chunk = max
+	}
+	var body bytes.Buffer
+	var reserved int64
+	for {
+		if !r.budget.reserve(chunk, max) {
+			r.budget.skip()
+			break
+		}
+		reserved += chunk
+		_, err := io.CopyN(&body, resp.Body, chunk)
+		if err == io.EOF {
+			resp.Body.Close()
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body.Bytes()))
+			return func() { r.budget.release(reserved) }, true
+		}
+		if err != nil {
+			r.logger().Printf("Can't read the response body to buffer it, plase check. Err: %v\n", err)
+			break
+		}
+	}
+	r.budget.release(reserved)
+	restoreBody(resp, body.Bytes())
+	return nil, false
+}
@@ -0,0 +1,99 @@
+package httpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+// newSizedServer will start a server replying with a body of the `size` query parameter,
+// chunked with an unknown length when the `chunked` query parameter is set
+func newSizedServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size, err := strconv.Atoi(r.URL.Query().Get("size"))
+		require.NoError(t, err)
+		w.Header().Set("Cache-Control", "max-age=3600")
+		if r.URL.Query().Get("chunked") == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(size))
+		}
+		w.WriteHeader(http.StatusOK)
+		// flushed in two parts, without Content-Length it's a chunked body of unknown length
+		_, err = w.Write([]byte(strings.Repeat("a", size/2)))
+		require.NoError(t, err)
+		w.(http.Flusher).Flush()
+		_, err = w.Write([]byte(strings.Repeat("a", size-size/2)))
+		require.NoError(t, err)
+	}))
+}
+
+func TestMaxBufferedBytes(t *testing.T) {
+	server := newSizedServer(t)
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.MaxBufferedBytes = 100
+	client := &http.Client{Transport: handler}
+
+	var skips int64
+	for _, target := range []struct {
+		query  string
+		size   int
+		stored bool
+	}{
+		{"?size=50", 50, true},
+		{"?size=500", 500, false},
+		{"?size=50&chunked=1", 50, true},
+		{"?size=500&chunked=1", 500, false},
+	} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+target.query, nil)
+		require.NoError(t, err)
+		_, body := doRequest(t, client, req)
+		// the body is intact either way
+		require.Len(t, body, target.size, target.query)
+
+		resp, body := doRequest(t, client, req)
+		require.Len(t, body, target.size, target.query)
+		require.Equal(t, target.stored, resp.Header.Get(httpcache.XFromHache) == "true", target.query)
+
+		if !target.stored {
+			// on both requests
+			skips += 2
+		}
+		stats := handler.Stats()
+		require.Zero(t, stats.BufferedBytes)
+		require.Equal(t, skips, stats.BudgetSkips, target.query)
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	server := newSizedServer(t)
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.MaxBodyBytes = 100
+	client := &http.Client{Transport: handler}
+
+	for _, target := range []struct {
+		query  string
+		size   int
+		stored bool
+	}{
+		{"?size=100", 100, true},
+		{"?size=101", 101, false},
+		{"?size=100&chunked=1", 100, true},
+		{"?size=101&chunked=1", 101, false},
+	} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+target.query, nil)
+		require.NoError(t, err)
+		_, body := doRequest(t, client, req)
+		// the body is intact either way
+		require.Len(t, body, target.size, target.query)
+
+		resp, body := doRequest(t, client, req)
+		require.Len(t, body, target.size, target.query)
+		require.Equal(t, target.stored, resp.Header.Get(httpcache.XFromHache) == "true", target.query)
+	}
+}
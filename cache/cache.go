@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"errors"
 	"time"
 )
@@ -20,24 +21,114 @@ var (
 const (
 	CacheStorageInMemory = "IN-MEMORY"
 	CacheRedis           = "REDIS"
+	CacheStorageDisk     = "DISK"
+	CacheStorageTiered   = "TIERED"
+	CacheStorageNoop     = "NOOP"
 	// TODO (bxcodec): Add another storage type
 )
 
 // ICacheInteractor ...
+//
+// The ttl given to Set is the lifetime of the value in the storage, the storage can drop the value after it.
+// A zero ttl leaves the lifetime to the storage, e.g. its default expiration.
 type ICacheInteractor interface {
-	Set(key string, value CachedResponse) error
+	Set(key string, value CachedResponse, ttl time.Duration) error
 	Get(key string) (CachedResponse, error)
 	Delete(key string) error
 	Flush() error
 	Origin() string
 }
 
+// IKeyLister is an optional capability of a cache storage that can list all of its stored keys
+type IKeyLister interface {
+	Keys() ([]string, error)
+}
+
+// IPinger is an optional capability of a cache storage that can check its connectivity
+type IPinger interface {
+	Ping(ctx context.Context) error
+}
+
+// ICloser is an optional capability of a cache storage holding resources (e.g. connections) to release
+// once it's no longer used
+type ICloser interface {
+	Close() error
+}
+
+// ISweeper is an optional capability of a cache storage that can delete its expired entries at once, instead of
+// expiring them lazily when they are read. It returns the number of deleted entries.
+type ISweeper interface {
+	Sweep() (int, error)
+}
+
+// ITTLReporter is an optional capability of a cache storage that can report the remaining lifetime of a stored
+// value, zero when it's kept without expiration. It returns ErrCacheMissed when the key isn't stored.
+type ITTLReporter interface {
+	TTL(key string) (time.Duration, error)
+}
+
+// RemainingTTL will return the ttl to copy the value of the key read from the storage to another storage, so the
+// copy doesn't outlive it: the time until its ExpiresAt, else the lifetime reported by the storage when it's an
+// ITTLReporter. It's false when the value is already expired, or when its lifetime is unknown.
+func RemainingTTL(storage ICacheInteractor, key string, value CachedResponse) (time.Duration, bool) {
+	if !value.ExpiresAt.IsZero() {
+		ttl := time.Until(value.ExpiresAt)
+		return ttl, ttl > 0
+	}
+	reporter, ok := storage.(ITTLReporter)
+	if !ok {
+		return 0, false
+	}
+	ttl, err := reporter.TTL(key)
+	return ttl, err == nil && ttl >= 0
+}
+
+// Logger is the destination of the logs of a cache storage, e.g. a *log.Logger
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// NopLogger discards every log, it's the default Logger of the storages
+type NopLogger struct{}
+
+// Printf ...
+func (NopLogger) Printf(format string, args ...interface{}) {}
+
+// IStatsReporter is an optional capability of a cache storage that can report its live statistics
+type IStatsReporter interface {
+	Stats() Stats
+}
+
+// Stats represent the content of a cache storage, and the results of its Get calls since it was created
+type Stats struct {
+	Entries int64 // The stored entries
+	Bytes   int64 // The size of the stored dumped responses
+	Hits    int64 // The Get calls returning an entry
+	Misses  int64 // The Get calls returning ErrCacheMissed
+}
+
 // CachedResponse represent the cacher struct item
 type CachedResponse struct {
 	DumpedResponse []byte    `json:"response"`      // The dumped response body
 	RequestURI     string    `json:"requestUri"`    // The requestURI of the response
 	RequestMethod  string    `json:"requestMethod"` // The HTTP Method that call the request for this response
 	CachedTime     time.Time `json:"cachedTime"`    // The timestamp when this response is Cached
+	// The explicit expiration of this response, it overrides the freshness computed from
+	// the response headers when not zero
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+	// The request values of the headers listed by the Vary header of this response, keyed by canonical name
+	VaryHeaders map[string][]string `json:"varyHeaders,omitempty"`
+	// The trailers of the response, the dumped response only keeps those of a chunked body
+	Trailer map[string][]string `json:"trailer,omitempty"`
+	// Whether the DumpedResponse is compressed
+	Compressed bool `json:"compressed,omitempty"`
+	// The algorithm of the compressed DumpedResponse (e.g. "br"), gzip when empty
+	Codec string `json:"codec,omitempty"`
+	// The random fraction in [0, 1) of the refresh-ahead window of this response that is skipped, so the
+	// responses expiring together aren't refreshed together
+	RefreshJitter float64 `json:"refreshJitter,omitempty"`
+	// The request values of the VaryHeaders of the last variants stored under this Vary index
+	Variants []map[string][]string `json:"variants,omitempty"`
 }
 
 // Validate will validate the cached response
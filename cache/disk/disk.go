@@ -0,0 +1,264 @@
+package disk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bxcodec/httpcache/cache"
+)
+
+// fileExt is the extension of the stored files, the other files of the directory are ignored
+const fileExt = ".json"
+
+type diskCache struct {
+	dir   string
+	index *index // nil without NewIndexedCache
+}
+
+// record is the content of a stored file, with its key to list it and the deadline of its ttl
+type record struct {
+	Key       string               `json:"key"`
+	Value     cache.CachedResponse `json:"value"`
+	ExpiresAt time.Time            `json:"expiresAt,omitempty"`
+}
+
+// NewCache will return the disk cache handler storing every entry in a file of the directory, created when missing.
+// The files are written atomically, so several handlers (or processes) can share the directory.
+func NewCache(dir string) cache.ICacheInteractor {
+	return &diskCache{
+		dir: dir,
+	}
+}
+
+// path will return the file of the key, named by its hash so any key is a valid file name
+func (i *diskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(i.dir, hex.EncodeToString(sum[:])+fileExt)
+}
+
+// Set will store the value, a positive ttl expires it. The file is written aside then renamed,
+// so a concurrent Get reads either the previous value or the new one.
+func (i *diskCache) Set(key string, value cache.CachedResponse, ttl time.Duration) (err error) {
+	stored := record{Key: key, Value: value}
+	if ttl > 0 {
+		stored.ExpiresAt = time.Now().Add(ttl)
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("%w: %v", cache.ErrFailedToSaveToCache, err)
+	}
+	if err = os.MkdirAll(i.dir, 0700); err != nil {
+		return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	tmp, err := ioutil.TempFile(i.dir, ".tmp-")
+	if err != nil {
+		return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	defer os.Remove(tmp.Name()) // a no-op once renamed
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	if err = os.Rename(tmp.Name(), i.path(key)); err != nil {
+		return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	if i.index != nil {
+		return i.index.append(i, indexLine{Op: indexSet, Key: key, File: filepath.Base(i.path(key)), ExpiresAt: stored.ExpiresAt})
+	}
+	return nil
+}
+
+func (i *diskCache) Get(key string) (res cache.CachedResponse, err error) {
+	stored, err := i.read(i.path(key))
+	if err != nil {
+		return
+	}
+	if stored.Key != key {
+		// a hash collision
+		return res, cache.ErrCacheMissed
+	}
+	if !stored.ExpiresAt.IsZero() && !time.Now().Before(stored.ExpiresAt) {
+		// expired lazily
+		_ = i.Delete(key)
+		return res, cache.ErrCacheMissed
+	}
+	return stored.Value, nil
+}
+
+// TTL will return the remaining lifetime given by the ttl of Set, zero when the file is kept without expiration
+func (i *diskCache) TTL(key string) (ttl time.Duration, err error) {
+	stored, err := i.read(i.path(key))
+	if err != nil {
+		return
+	}
+	if stored.Key != key {
+		return 0, cache.ErrCacheMissed
+	}
+	if stored.ExpiresAt.IsZero() {
+		return 0, nil
+	}
+	if ttl = time.Until(stored.ExpiresAt); ttl <= 0 {
+		return 0, cache.ErrCacheMissed
+	}
+	return ttl, nil
+}
+
+// read will decode the stored file
+func (i *diskCache) read(path string) (stored record, err error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return stored, cache.ErrCacheMissed
+	}
+	if err != nil {
+		return stored, fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	if err = json.Unmarshal(data, &stored); err != nil {
+		return stored, fmt.Errorf("%w: %v", cache.ErrInvalidCachedResponse, err)
+	}
+	return stored, nil
+}
+
+func (i *diskCache) Delete(key string) (err error) {
+	if err = os.Remove(i.path(key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	if i.index != nil {
+		return i.index.append(i, indexLine{Op: indexDel, Key: key})
+	}
+	return nil
+}
+
+func (i *diskCache) Origin() string {
+	return cache.CacheStorageDisk
+}
+
+// Flush will delete the stored files, the directory and its other files are kept
+func (i *diskCache) Flush() error {
+	paths, err := i.files()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+		}
+	}
+	if i.index != nil {
+		return i.index.append(i, indexLine{Op: indexFlush})
+	}
+	return nil
+}
+
+// Keys will list the keys of the stored files, the unreadable files are skipped. With the index, they are listed
+// without reading the directory.
+func (i *diskCache) Keys() ([]string, error) {
+	if i.index != nil {
+		entries, err := i.index.snapshot(i)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(entries))
+		for key := range entries {
+			keys = append(keys, key)
+		}
+		return keys, nil
+	}
+	paths, err := i.files()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if stored, err := i.read(path); err == nil {
+			keys = append(keys, stored.Key)
+		}
+	}
+	return keys, nil
+}
+
+// Sweep will delete the expired files, the unreadable ones are kept. With the index, the expired files are known
+// without reading the directory nor the files.
+func (i *diskCache) Sweep() (deleted int, err error) {
+	now := time.Now()
+	if i.index != nil {
+		entries, err := i.index.snapshot(i)
+		if err != nil {
+			return 0, err
+		}
+		for key, entry := range entries {
+			if entry.ExpiresAt.IsZero() || now.Before(entry.ExpiresAt) {
+				continue
+			}
+			if err = i.Delete(key); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+		return deleted, nil
+	}
+	paths, err := i.files()
+	if err != nil {
+		return 0, err
+	}
+	for _, path := range paths {
+		stored, err := i.read(path)
+		if err != nil || stored.ExpiresAt.IsZero() || now.Before(stored.ExpiresAt) {
+			continue
+		}
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return deleted, fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Close will release the log of the index, it's a no-op without the index
+func (i *diskCache) Close() error {
+	if i.index == nil {
+		return nil
+	}
+	return i.index.close()
+}
+
+// files will return the paths of the stored files
+func (i *diskCache) files() ([]string, error) {
+	infos, err := ioutil.ReadDir(i.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	var paths []string
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasSuffix(info.Name(), fileExt) {
+			paths = append(paths, filepath.Join(i.dir, info.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// Ping will check the directory can be written
+func (i *diskCache) Ping(ctx context.Context) error {
+	if err := os.MkdirAll(i.dir, 0700); err != nil {
+		return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	tmp, err := ioutil.TempFile(i.dir, ".tmp-")
+	if err != nil {
+		return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	tmp.Close()
+	return os.Remove(tmp.Name())
+}
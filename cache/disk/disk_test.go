@@ -0,0 +1,303 @@
+package disk_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache/cache"
+	"github.com/bxcodec/httpcache/cache/disk"
+)
+
+func newDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "httpcache-disk")
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	return dir
+}
+
+func TestCacheDisk(t *testing.T) {
+	dir := newDir(t)
+	defer os.RemoveAll(dir)
+
+	cacheObj := disk.NewCache(dir)
+	testKey := "GET http://bxcodec.io"
+	testVal := cache.CachedResponse{
+		DumpedResponse: []byte("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello"),
+		RequestURI:     "http://bxcodec.io",
+		RequestMethod:  "GET",
+		CachedTime:     time.Now(),
+	}
+
+	// Try to SET item
+	err := cacheObj.Set(testKey, testVal, 0)
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+
+	// try to GET item from another cache on the same directory, e.g. after a restart
+	res, err := disk.NewCache(dir).Get(testKey)
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	// assert the content
+	if string(res.DumpedResponse) != string(testVal.DumpedResponse) {
+		t.Fatalf("expected %q, got %q", testVal.DumpedResponse, res.DumpedResponse)
+	}
+	if res.RequestURI != testVal.RequestURI {
+		t.Fatalf("expected %v, got %v", testVal.RequestURI, res.RequestURI)
+	}
+	if res.RequestMethod != testVal.RequestMethod {
+		t.Fatalf("expected %v, got %v", testVal.RequestMethod, res.RequestMethod)
+	}
+	if !res.CachedTime.Equal(testVal.CachedTime) {
+		t.Fatalf("expected %v, got %v", testVal.CachedTime, res.CachedTime)
+	}
+
+	// try to DELETE the item
+	err = cacheObj.Delete(testKey)
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+
+	// try to re-GET item from cache after deleted
+	_, err = cacheObj.Get(testKey)
+	if err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+
+	// deleting a missing item is not an error
+	err = cacheObj.Delete(testKey)
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+}
+
+func TestCacheDiskTTL(t *testing.T) {
+	dir := newDir(t)
+	defer os.RemoveAll(dir)
+
+	cacheObj := disk.NewCache(dir)
+	err := cacheObj.Set("KEY", cache.CachedResponse{RequestMethod: "GET", CachedTime: time.Now()}, time.Millisecond*100)
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err = cacheObj.Get("KEY"); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if ttl, err := cacheObj.(cache.ITTLReporter).TTL("KEY"); err != nil || ttl <= 0 || ttl > time.Millisecond*100 {
+		t.Fatalf("expected a remaining ttl, got %v and %v", ttl, err)
+	}
+
+	time.Sleep(time.Millisecond * 150)
+	if _, err = cacheObj.(cache.ITTLReporter).TTL("KEY"); err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+	if _, err = cacheObj.Get("KEY"); err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+}
+
+func TestCacheDiskKeysAndFlush(t *testing.T) {
+	dir := newDir(t)
+	defer os.RemoveAll(dir)
+
+	cacheObj := disk.NewCache(dir)
+	for _, key := range []string{"KEY-1", "KEY-2"} {
+		err := cacheObj.Set(key, cache.CachedResponse{RequestMethod: "GET", CachedTime: time.Now()}, 0)
+		if err != nil {
+			t.Fatalf("expected %v, got %v", nil, err)
+		}
+	}
+
+	keys, err := cacheObj.(cache.IKeyLister).Keys()
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected %v, got %v", 2, len(keys))
+	}
+
+	if err = cacheObj.Flush(); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	keys, err = cacheObj.(cache.IKeyLister).Keys()
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("expected %v, got %v", 0, len(keys))
+	}
+}
+
+func TestCacheDiskConcurrentAccess(t *testing.T) {
+	dir := newDir(t)
+	defer os.RemoveAll(dir)
+
+	cacheObj := disk.NewCache(dir)
+	err := cacheObj.Set("KEY", cache.CachedResponse{RequestMethod: "GET", RequestURI: "0", CachedTime: time.Now()}, 0)
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for n := 0; n < 50; n++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- cacheObj.Set("KEY", cache.CachedResponse{RequestMethod: "GET", RequestURI: "1", CachedTime: time.Now()}, 0)
+		}()
+		go func() {
+			defer wg.Done()
+			// never a partially written file
+			_, err := cacheObj.Get("KEY")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("expected %v, got %v", nil, err)
+		}
+	}
+}
+
+func TestCacheDiskIndexSweep(t *testing.T) {
+	dir := newDir(t)
+	defer os.RemoveAll(dir)
+
+	cacheObj := disk.NewIndexedCache(dir)
+	defer cacheObj.(cache.ICloser).Close()
+	testVal := cache.CachedResponse{RequestMethod: "GET", CachedTime: time.Now()}
+	if err := cacheObj.Set("EXPIRING", testVal, time.Millisecond*50); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if err := cacheObj.Set("KEPT", testVal, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expected %v files, got %v and %v", 2, files, err)
+	}
+	// the expired files are known from the index, they are deleted even when they can't be read anymore
+	for _, file := range files {
+		if err = ioutil.WriteFile(file, []byte("corrupted"), 0600); err != nil {
+			t.Fatalf("expected %v, got %v", nil, err)
+		}
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	deleted, err := cacheObj.(cache.ISweeper).Sweep()
+	if err != nil || deleted != 1 {
+		t.Fatalf("expected %v deleted, got %v and %v", 1, deleted, err)
+	}
+	if files, _ = filepath.Glob(filepath.Join(dir, "*.json")); len(files) != 1 {
+		t.Fatalf("expected %v files, got %v", 1, files)
+	}
+	keys, err := cacheObj.(cache.IKeyLister).Keys()
+	if err != nil || !reflect.DeepEqual(keys, []string{"KEPT"}) {
+		t.Fatalf("expected %v, got %v and %v", []string{"KEPT"}, keys, err)
+	}
+
+	// without the index, the files are read
+	cacheObj = disk.NewCache(dir)
+	if err = cacheObj.Set("EXPIRING", testVal, time.Millisecond*50); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	time.Sleep(time.Millisecond * 100)
+	if deleted, err = cacheObj.(cache.ISweeper).Sweep(); err != nil || deleted != 1 {
+		t.Fatalf("expected %v deleted, got %v and %v", 1, deleted, err)
+	}
+}
+
+func TestCacheDiskIndexRebuild(t *testing.T) {
+	dir := newDir(t)
+	defer os.RemoveAll(dir)
+
+	cacheObj := disk.NewIndexedCache(dir)
+	testVal := cache.CachedResponse{RequestMethod: "GET", CachedTime: time.Now()}
+	for _, key := range []string{"KEY-1", "KEY-2"} {
+		if err := cacheObj.Set(key, testVal, 0); err != nil {
+			t.Fatalf("expected %v, got %v", nil, err)
+		}
+	}
+	if err := cacheObj.(cache.ICloser).Close(); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+
+	for name, damage := range map[string]func(index string) error{
+		"corrupted": func(index string) error { return ioutil.WriteFile(index, []byte("{\"op\":\"set\",\"ke"), 0600) },
+		"missing":   os.Remove,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := damage(filepath.Join(dir, ".index")); err != nil {
+				t.Fatalf("expected %v, got %v", nil, err)
+			}
+			// rebuilt from the stored files, and written back
+			for n := 0; n < 2; n++ {
+				cacheObj := disk.NewIndexedCache(dir)
+				keys, err := cacheObj.(cache.IKeyLister).Keys()
+				if err != nil {
+					t.Fatalf("expected %v, got %v", nil, err)
+				}
+				sort.Strings(keys)
+				if !reflect.DeepEqual(keys, []string{"KEY-1", "KEY-2"}) {
+					t.Fatalf("expected %v, got %v", []string{"KEY-1", "KEY-2"}, keys)
+				}
+				if err = cacheObj.(cache.ICloser).Close(); err != nil {
+					t.Fatalf("expected %v, got %v", nil, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheDiskIndexCompaction(t *testing.T) {
+	dir := newDir(t)
+	defer os.RemoveAll(dir)
+
+	cacheObj := disk.NewIndexedCache(dir)
+	testVal := cache.CachedResponse{RequestMethod: "GET", CachedTime: time.Now()}
+	for _, key := range []string{"KEY-1", "KEY-2", "KEY-3"} {
+		if err := cacheObj.Set(key, testVal, 0); err != nil {
+			t.Fatalf("expected %v, got %v", nil, err)
+		}
+	}
+	// the log is compacted while it's used, not only once loaded again
+	for n := 0; n < 100; n++ {
+		if err := cacheObj.Set("KEY-1", testVal, 0); err != nil {
+			t.Fatalf("expected %v, got %v", nil, err)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, ".index"))
+		if err != nil {
+			t.Fatalf("expected %v, got %v", nil, err)
+		}
+		if lines := bytes.Count(data, []byte("\n")); lines > 6 {
+			t.Fatalf("expected at most %v lines, got %v", 6, lines)
+		}
+	}
+	if err := cacheObj.Delete("KEY-2"); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if err := cacheObj.(cache.ICloser).Close(); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+
+	keys, err := disk.NewIndexedCache(dir).(cache.IKeyLister).Keys()
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"KEY-1", "KEY-3"}) {
+		t.Fatalf("expected %v, got %v", []string{"KEY-1", "KEY-3"}, keys)
+	}
+}
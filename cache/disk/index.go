@@ -0,0 +1,232 @@
+package disk
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bxcodec/httpcache/cache"
+)
+
+// indexFile is the append-only log of the index, in the directory of the stored files
+const indexFile = ".index"
+
+// Index log operations
+const (
+	indexSet   = "set"
+	indexDel   = "delete"
+	indexFlush = "flush"
+)
+
+// indexLine is an operation of the index log
+type indexLine struct {
+	Op        string    `json:"op"`
+	Key       string    `json:"key,omitempty"`
+	File      string    `json:"file,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+}
+
+// indexEntry is the stored file of a key, with the deadline of its ttl
+type indexEntry struct {
+	File      string
+	ExpiresAt time.Time
+}
+
+// index keep the keys of the stored files in memory, persisted to an append-only log. It's loaded once from the
+// log, or rebuilt by reading the stored files when the log is missing or corrupted.
+type index struct {
+	dir string
+
+	mu      sync.Mutex
+	entries map[string]indexEntry
+	lines   int      // of the log, the dead ones are compacted once they outnumber the entries
+	log     *os.File // nil until loaded
+}
+
+// NewIndexedCache will return the disk cache handler of NewCache, that also keeps an index of the stored files,
+// so Keys and Sweep don't read the whole directory. The index is only updated by this storage: several handlers
+// (or processes) must not write the directory, a Sweep would miss the files they stored.
+func NewIndexedCache(dir string) cache.ICacheInteractor {
+	return &diskCache{
+		dir:   dir,
+		index: &index{dir: dir},
+	}
+}
+
+// load will read the log once, the index is rebuilt (and the log rewritten) when it can't be read
+func (x *index) load(c *diskCache) error {
+	if x.log != nil {
+		return nil
+	}
+	entries, lines, err := x.read()
+	if err != nil {
+		if entries, err = x.rebuild(c); err != nil {
+			return err
+		}
+		lines = -1
+	}
+	x.entries, x.lines = entries, lines
+	if lines < 0 || x.compactable() {
+		return x.compact()
+	}
+	return x.open()
+}
+
+// compactable will check if the log has more dead lines than entries
+func (x *index) compactable() bool {
+	return x.lines > 2*len(x.entries)
+}
+
+// compact will rewrite the log with the current entries only, and reopen it
+func (x *index) compact() error {
+	if err := x.rewrite(); err != nil {
+		return err
+	}
+	return x.open()
+}
+
+// open will open the log to append to it
+func (x *index) open() (err error) {
+	if x.log, err = os.OpenFile(filepath.Join(x.dir, indexFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600); err != nil {
+		return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	return nil
+}
+
+// read will replay the log, any line that can't be decoded makes it corrupted
+func (x *index) read() (entries map[string]indexEntry, lines int, err error) {
+	f, err := os.Open(filepath.Join(x.dir, indexFile))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	entries = make(map[string]indexEntry)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines++
+		var line indexLine
+		if err = json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, 0, err
+		}
+		switch line.Op {
+		case indexSet:
+			entries[line.Key] = indexEntry{File: line.File, ExpiresAt: line.ExpiresAt}
+		case indexDel:
+			delete(entries, line.Key)
+		case indexFlush:
+			entries = make(map[string]indexEntry)
+		default:
+			return nil, 0, fmt.Errorf("unknown index operation %q", line.Op)
+		}
+	}
+	return entries, lines, scanner.Err()
+}
+
+// rebuild will read every stored file, the unreadable ones are skipped
+func (x *index) rebuild(c *diskCache) (map[string]indexEntry, error) {
+	paths, err := c.files()
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]indexEntry, len(paths))
+	for _, path := range paths {
+		if stored, err := c.read(path); err == nil {
+			entries[stored.Key] = indexEntry{File: filepath.Base(path), ExpiresAt: stored.ExpiresAt}
+		}
+	}
+	return entries, nil
+}
+
+// rewrite will replace the log with the current entries, written aside then renamed
+func (x *index) rewrite() (err error) {
+	if err = os.MkdirAll(x.dir, 0700); err != nil {
+		return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	tmp, err := ioutil.TempFile(x.dir, ".tmp-")
+	if err != nil {
+		return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	defer os.Remove(tmp.Name()) // a no-op once renamed
+	enc := json.NewEncoder(tmp)
+	for key, entry := range x.entries {
+		if err = enc.Encode(indexLine{Op: indexSet, Key: key, File: entry.File, ExpiresAt: entry.ExpiresAt}); err != nil {
+			tmp.Close()
+			return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+		}
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	if x.log != nil {
+		x.log.Close()
+		x.log = nil
+	}
+	if err = os.Rename(tmp.Name(), filepath.Join(x.dir, indexFile)); err != nil {
+		return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	x.lines = len(x.entries)
+	return nil
+}
+
+// append will apply the operation to the index, and log it. The log is compacted once the dead lines
+// outnumber the entries, so it stays within twice their number.
+func (x *index) append(c *diskCache, line indexLine) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if err := x.load(c); err != nil {
+		return err
+	}
+	switch line.Op {
+	case indexSet:
+		x.entries[line.Key] = indexEntry{File: line.File, ExpiresAt: line.ExpiresAt}
+	case indexDel:
+		if _, ok := x.entries[line.Key]; !ok {
+			return nil
+		}
+		delete(x.entries, line.Key)
+	case indexFlush:
+		x.entries = make(map[string]indexEntry)
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	if _, err = x.log.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	if x.lines++; x.compactable() {
+		return x.compact()
+	}
+	return nil
+}
+
+// snapshot will return a copy of the entries
+func (x *index) snapshot(c *diskCache) (map[string]indexEntry, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if err := x.load(c); err != nil {
+		return nil, err
+	}
+	entries := make(map[string]indexEntry, len(x.entries))
+	for key, entry := range x.entries {
+		entries[key] = entry
+	}
+	return entries, nil
+}
+
+// close will release the log
+func (x *index) close() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.log == nil {
+		return nil
+	}
+	err := x.log.Close()
+	x.log = nil
+	return err
+}
@@ -1,14 +1,29 @@
 package inmem
 
 import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	memcache "github.com/bxcodec/gotcha/cache"
 	"github.com/bxcodec/httpcache/cache"
 )
 
 type inmemCache struct {
+	hits   int64 // first, for the 64-bit alignment of the atomic counters
+	misses int64
+	// mu serializes the calls to the in-memory cache, its Get moves the entry in the LRU list with a read lock only
+	mu    sync.Mutex
 	cache memcache.Cache
 }
 
+// item is the stored value, with the deadline of its ttl
+type item struct {
+	Value     cache.CachedResponse
+	ExpiresAt time.Time
+}
+
 // NewCache will return the inmemory cache handler
 func NewCache(c memcache.Cache) cache.ICacheInteractor {
 	return &inmemCache{
@@ -16,20 +31,64 @@ func NewCache(c memcache.Cache) cache.ICacheInteractor {
 	}
 }
 
-func (i *inmemCache) Set(key string, value cache.CachedResponse) (err error) {
-	return i.cache.Set(key, value)
+// Set will store the value, a positive ttl expires it sooner than the expiry time of the in-memory cache
+func (i *inmemCache) Set(key string, value cache.CachedResponse, ttl time.Duration) (err error) {
+	stored := item{Value: value}
+	if ttl > 0 {
+		stored.ExpiresAt = time.Now().Add(ttl)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.cache.Set(key, stored)
 }
 
 func (i *inmemCache) Get(key string) (res cache.CachedResponse, err error) {
-	item, err := i.cache.Get(key)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	val, err := i.cache.Get(key)
+	if err == memcache.ErrMissed {
+		atomic.AddInt64(&i.misses, 1)
+		return res, cache.ErrCacheMissed
+	}
 	if err != nil {
 		return
 	}
-	res = item.(cache.CachedResponse)
-	return
+	stored := val.(item)
+	if !stored.ExpiresAt.IsZero() && !time.Now().Before(stored.ExpiresAt) {
+		// expired lazily, the in-memory cache only knows its own expiry time
+		_ = i.cache.Delete(key)
+		atomic.AddInt64(&i.misses, 1)
+		return res, cache.ErrCacheMissed
+	}
+	atomic.AddInt64(&i.hits, 1)
+	return stored.Value, nil
+}
+
+// TTL will return the remaining lifetime given by the ttl of Set, zero when it's only the expiry time of the
+// in-memory cache
+func (i *inmemCache) TTL(key string) (ttl time.Duration, err error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	val, err := i.cache.Get(key)
+	if err == memcache.ErrMissed {
+		return 0, cache.ErrCacheMissed
+	}
+	if err != nil {
+		return
+	}
+	stored := val.(item)
+	if stored.ExpiresAt.IsZero() {
+		return 0, nil
+	}
+	if ttl = time.Until(stored.ExpiresAt); ttl <= 0 {
+		return 0, cache.ErrCacheMissed
+	}
+	return ttl, nil
 }
 
 func (i *inmemCache) Delete(key string) (err error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
 	return i.cache.Delete(key)
 }
 
@@ -38,5 +97,47 @@ func (i *inmemCache) Origin() string {
 }
 
 func (i *inmemCache) Flush() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
 	return i.cache.ClearCache()
 }
+
+func (i *inmemCache) Keys() ([]string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.cache.GetKeys()
+}
+
+func (i *inmemCache) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (i *inmemCache) Close() error {
+	return nil
+}
+
+// Stats will read every stored entry to count them and their size, so it's meant for an occasional introspection.
+// The entries read are not counted as hits.
+func (i *inmemCache) Stats() (stats cache.Stats) {
+	stats.Hits, stats.Misses = atomic.LoadInt64(&i.hits), atomic.LoadInt64(&i.misses)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	keys, err := i.cache.GetKeys()
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for _, key := range keys {
+		val, err := i.cache.Get(key)
+		if err != nil {
+			continue // evicted since the keys are listed
+		}
+		stored := val.(item)
+		if !stored.ExpiresAt.IsZero() && !now.Before(stored.ExpiresAt) {
+			continue
+		}
+		stats.Entries++
+		stats.Bytes += int64(len(stored.Value.DumpedResponse))
+	}
+	return
+}
@@ -1,6 +1,7 @@
 package inmem_test
 
 import (
+	"sync"
 	"testing"
 	"time"
 
@@ -26,7 +27,7 @@ func TestCacheInMemory(t *testing.T) {
 	}
 
 	// Try to SET item
-	err := cacheObj.Set(testKey, testVal)
+	err := cacheObj.Set(testKey, testVal, 0)
 	if err != nil {
 		t.Fatalf("expected %v, got %v", nil, err)
 	}
@@ -57,3 +58,131 @@ func TestCacheInMemory(t *testing.T) {
 		t.Fatalf("expected %v, got %v", err, nil)
 	}
 }
+
+func TestCacheInMemoryKeys(t *testing.T) {
+	c := gotcha.New(
+		gotcha.NewOption().SetAlgorithm(inmemcache.LRUAlgorithm).
+			SetExpiryTime(0).SetMaxSizeItem(100),
+	)
+
+	cacheObj := inmem.NewCache(c)
+	for _, key := range []string{"KEY-1", "KEY-2"} {
+		err := cacheObj.Set(key, cache.CachedResponse{RequestMethod: "GET", CachedTime: time.Now()}, 0)
+		if err != nil {
+			t.Fatalf("expected %v, got %v", nil, err)
+		}
+	}
+
+	keys, err := cacheObj.(cache.IKeyLister).Keys()
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected %v, got %v", 2, len(keys))
+	}
+}
+
+func TestCacheInMemoryTTL(t *testing.T) {
+	c := gotcha.New(
+		gotcha.NewOption().SetAlgorithm(inmemcache.LRUAlgorithm).
+			SetExpiryTime(0).SetMaxSizeItem(100),
+	)
+
+	cacheObj := inmem.NewCache(c)
+	testVal := cache.CachedResponse{RequestMethod: "GET", CachedTime: time.Now()}
+	if err := cacheObj.Set("TTL", testVal, time.Millisecond*50); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if err := cacheObj.Set("NO-TTL", testVal, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err := cacheObj.Get("TTL"); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if ttl, err := cacheObj.(cache.ITTLReporter).TTL("TTL"); err != nil || ttl <= 0 || ttl > time.Millisecond*50 {
+		t.Fatalf("expected a remaining ttl, got %v and %v", ttl, err)
+	}
+	if ttl, err := cacheObj.(cache.ITTLReporter).TTL("NO-TTL"); err != nil || ttl != 0 {
+		t.Fatalf("expected %v, got %v and %v", 0, ttl, err)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	if _, err := cacheObj.Get("TTL"); err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+	if _, err := cacheObj.Get("NO-TTL"); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err := cacheObj.(cache.ITTLReporter).TTL("TTL"); err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+}
+
+func TestCacheInMemoryStats(t *testing.T) {
+	c := gotcha.New(
+		gotcha.NewOption().SetAlgorithm(inmemcache.LRUAlgorithm).
+			SetExpiryTime(0).SetMaxSizeItem(100),
+	)
+	cacheObj := inmem.NewCache(c)
+	testVal := cache.CachedResponse{
+		DumpedResponse: []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"),
+		RequestURI:     "http://bxcodec.io",
+		RequestMethod:  "GET",
+		CachedTime:     time.Now(),
+	}
+	if err := cacheObj.Set("KEY-1", testVal, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if err := cacheObj.Set("KEY-2", testVal, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	// expired, it's neither an entry nor a hit
+	if err := cacheObj.Set("KEY-3", testVal, time.Millisecond); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	time.Sleep(time.Millisecond * 5)
+	_, _ = cacheObj.Get("KEY-1")
+	_, _ = cacheObj.Get("KEY-3")
+	_, _ = cacheObj.Get("MISSING")
+
+	stats := cacheObj.(cache.IStatsReporter).Stats()
+	expected := cache.Stats{Entries: 2, Bytes: int64(2 * len(testVal.DumpedResponse)), Hits: 1, Misses: 2}
+	if stats != expected {
+		t.Fatalf("expected %+v, got %+v", expected, stats)
+	}
+}
+
+// TestCacheInMemoryConcurrent is meant for the race detector, the LRU list is updated by every Get
+func TestCacheInMemoryConcurrent(t *testing.T) {
+	c := gotcha.New(
+		gotcha.NewOption().SetAlgorithm(inmemcache.LRUAlgorithm).
+			SetExpiryTime(0).SetMaxSizeItem(100),
+	)
+	cacheObj := inmem.NewCache(c)
+	testVal := cache.CachedResponse{RequestURI: "http://bxcodec.io", RequestMethod: "GET", CachedTime: time.Now()}
+	keys := []string{"KEY-1", "KEY-2", "KEY-3"}
+	for _, key := range keys {
+		if err := cacheObj.Set(key, testVal, 0); err != nil {
+			t.Fatalf("expected %v, got %v", nil, err)
+		}
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := keys[(i+j)%len(keys)]
+				if _, err := cacheObj.Get(key); err != nil {
+					t.Errorf("expected %v, got %v", nil, err)
+					return
+				}
+				if err := cacheObj.Set(key, testVal, 0); err != nil {
+					t.Errorf("expected %v, got %v", nil, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
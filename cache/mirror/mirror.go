@@ -0,0 +1,174 @@
+package mirror
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bxcodec/httpcache/cache"
+)
+
+// queueSize is the number of pending writes to the secondary store, the writes beyond it are dropped
+const queueSize = 1024
+
+type write struct {
+	flush bool
+	del   bool
+	key   string
+	value cache.CachedResponse
+	ttl   time.Duration
+}
+
+type mirrorCache struct {
+	primary    cache.ICacheInteractor
+	secondary  cache.ICacheInteractor
+	readRepair bool
+	logger     cache.Logger
+
+	mu       sync.RWMutex // guards the queue against the writes enqueued while closing
+	closed   bool
+	queue    chan write
+	mirrored chan struct{} // closed once the queue is drained
+}
+
+// Option configures the mirror cache
+type Option func(m *mirrorCache)
+
+// WithLogger will send the logs of the mirror (the failed and the dropped mirrored writes, the failed repairs)
+// to the logger, they are discarded by default
+func WithLogger(logger cache.Logger) Option {
+	return func(m *mirrorCache) {
+		if logger != nil {
+			m.logger = logger
+		}
+	}
+}
+
+// NewCache will return a cache storage that reads and writes the primary storage, and mirrors every write
+// to the secondary storage in the background, e.g. to warm a new storage under the real traffic before a cutover.
+// The mirrored writes are applied in order, their errors are only logged (see WithLogger).
+// When the secondary storage can't keep up, the writes are dropped (and logged) instead of slowing the primary.
+func NewCache(primary, secondary cache.ICacheInteractor, opts ...Option) cache.ICacheInteractor {
+	m := &mirrorCache{
+		primary:   primary,
+		secondary: secondary,
+		logger:    cache.NopLogger{},
+		queue:     make(chan write, queueSize),
+		mirrored:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	go m.mirror()
+	return m
+}
+
+// NewReadRepairCache will return a cache storage mirroring the writes like NewCache, that also reads the secondary
+// storage on a primary miss. An entry found there is written back to the primary storage, so a primary
+// self-heals after a partial outage or a restart. The repaired entries keep their expiration (see
+// cache.RemainingTTL), the expired ones are not repaired, nor the ones whose expiration is unknown.
+func NewReadRepairCache(primary, secondary cache.ICacheInteractor, opts ...Option) cache.ICacheInteractor {
+	m := NewCache(primary, secondary, opts...).(*mirrorCache)
+	m.readRepair = true
+	return m
+}
+
+func (m *mirrorCache) mirror() {
+	defer close(m.mirrored)
+	for w := range m.queue {
+		var err error
+		switch {
+		case w.flush:
+			err = m.secondary.Flush()
+		case w.del:
+			err = m.secondary.Delete(w.key)
+		default:
+			err = m.secondary.Set(w.key, w.value, w.ttl)
+		}
+		if err != nil {
+			m.logger.Printf("Can't mirror the write to the secondary storage, plase check. Err: %v\n", err)
+		}
+	}
+}
+
+func (m *mirrorCache) enqueue(w write) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		m.logger.Printf("The mirror is closed, dropping the mirrored write of %q\n", w.key)
+		return
+	}
+	select {
+	case m.queue <- w:
+	default:
+		m.logger.Printf("The secondary storage is too slow, dropping the mirrored write of %q\n", w.key)
+	}
+}
+
+func (m *mirrorCache) Set(key string, value cache.CachedResponse, ttl time.Duration) (err error) {
+	if err = m.primary.Set(key, value, ttl); err != nil {
+		return
+	}
+	m.enqueue(write{key: key, value: value, ttl: ttl})
+	return
+}
+
+func (m *mirrorCache) Get(key string) (res cache.CachedResponse, err error) {
+	res, err = m.primary.Get(key)
+	if err != cache.ErrCacheMissed || !m.readRepair {
+		return
+	}
+	repaired, errSecondary := m.secondary.Get(key)
+	if errSecondary != nil {
+		return
+	}
+	ttl, ok := cache.RemainingTTL(m.secondary, key, repaired)
+	if !ok {
+		if !repaired.ExpiresAt.IsZero() {
+			return // already expired
+		}
+		// its lifetime is unknown, a repaired entry could outlive it
+		return repaired, nil
+	}
+	// not mirrored, it comes from the secondary storage
+	if errRepair := m.primary.Set(key, repaired, ttl); errRepair != nil {
+		m.logger.Printf("Can't repair the primary storage, plase check. Err: %v\n", errRepair)
+	}
+	return repaired, nil
+}
+
+func (m *mirrorCache) Delete(key string) (err error) {
+	err = m.primary.Delete(key)
+	// mirrored even when failing, the key must not outlive its deletion in the secondary storage
+	m.enqueue(write{del: true, key: key})
+	return
+}
+
+func (m *mirrorCache) Flush() (err error) {
+	err = m.primary.Flush()
+	m.enqueue(write{flush: true})
+	return
+}
+
+// Close will stop mirroring once the pending writes are applied to the secondary storage, then close both
+// storages, the ones without the capability are skipped. The writes after it are not mirrored anymore.
+func (m *mirrorCache) Close() (err error) {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+	m.mu.Unlock()
+	<-m.mirrored
+	for _, store := range []cache.ICacheInteractor{m.secondary, m.primary} {
+		if closer, ok := store.(cache.ICloser); ok {
+			if errClose := closer.Close(); err == nil {
+				err = errClose
+			}
+		}
+	}
+	return
+}
+
+func (m *mirrorCache) Origin() string {
+	return m.primary.Origin()
+}
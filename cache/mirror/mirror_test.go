@@ -0,0 +1,236 @@
+package mirror_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha"
+	inmemcache "github.com/bxcodec/gotcha/cache"
+	"github.com/bxcodec/httpcache/cache"
+	"github.com/bxcodec/httpcache/cache/inmem"
+	"github.com/bxcodec/httpcache/cache/mirror"
+)
+
+func newInmemCache() cache.ICacheInteractor {
+	return inmem.NewCache(gotcha.New(
+		gotcha.NewOption().SetAlgorithm(inmemcache.LRUAlgorithm).SetExpiryTime(time.Minute).SetMaxSizeItem(100),
+	))
+}
+
+// eventually will wait for the condition to be true
+func eventually(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(time.Second * 5)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("the condition is still false after 5s")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestMirror(t *testing.T) {
+	primary := newInmemCache()
+	secondary := newInmemCache()
+	c := mirror.NewCache(primary, secondary)
+	testVal := cache.CachedResponse{
+		DumpedResponse: []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"),
+		RequestURI:     "http://bxcodec.io",
+		RequestMethod:  "GET",
+		CachedTime:     time.Now(),
+	}
+
+	if err := c.Set("KEY", testVal, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	eventually(t, func() bool {
+		_, err := secondary.Get("KEY")
+		return err == nil
+	})
+
+	// the reads only use the primary storage
+	if err := secondary.Set("SECONDARY-ONLY", testVal, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err := c.Get("SECONDARY-ONLY"); err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+	if err := primary.Delete("KEY"); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err := c.Get("KEY"); err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+
+	if err := c.Set("KEY", testVal, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if err := c.Delete("KEY"); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	eventually(t, func() bool {
+		_, err := secondary.Get("KEY")
+		return err == cache.ErrCacheMissed
+	})
+}
+
+func TestReadRepair(t *testing.T) {
+	primary := newInmemCache()
+	secondary := newInmemCache()
+	c := mirror.NewReadRepairCache(primary, secondary)
+	testVal := cache.CachedResponse{
+		DumpedResponse: []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"),
+		RequestURI:     "http://bxcodec.io",
+		RequestMethod:  "GET",
+		CachedTime:     time.Now(),
+		ExpiresAt:      time.Now().Add(time.Minute),
+	}
+	if err := secondary.Set("KEY", testVal, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+
+	// a primary miss is served by the secondary storage, and repairs the primary
+	res, err := c.Get("KEY")
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if !res.ExpiresAt.Equal(testVal.ExpiresAt) {
+		t.Fatalf("expected %v, got %v", testVal.ExpiresAt, res.ExpiresAt)
+	}
+	repaired, err := primary.Get("KEY")
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if !repaired.ExpiresAt.Equal(testVal.ExpiresAt) {
+		t.Fatalf("expected %v, got %v", testVal.ExpiresAt, repaired.ExpiresAt)
+	}
+
+	// an expired entry is not repaired
+	testVal.ExpiresAt = time.Now().Add(-time.Second)
+	if err := secondary.Set("EXPIRED", testVal, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err := c.Get("EXPIRED"); err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+	if _, err := primary.Get("EXPIRED"); err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+
+	// without ExpiresAt, the repaired entry gets the remaining ttl of the secondary one
+	testVal.ExpiresAt = time.Time{}
+	if err := secondary.Set("TTL", testVal, time.Minute); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err := c.Get("TTL"); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if ttl, err := primary.(cache.ITTLReporter).TTL("TTL"); err != nil || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("expected a remaining ttl, got %v and %v", ttl, err)
+	}
+
+	// and when the secondary storage can't report it, the entry is served without repairing the primary
+	c = mirror.NewReadRepairCache(primary, struct{ cache.ICacheInteractor }{secondary})
+	if err := secondary.Set("UNKNOWN-TTL", testVal, time.Minute); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err := c.Get("UNKNOWN-TTL"); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err := primary.Get("UNKNOWN-TTL"); err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+}
+
+type closingCache struct {
+	cache.ICacheInteractor
+	closed int
+}
+
+func (c *closingCache) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestMirrorClose(t *testing.T) {
+	primary, secondary := &closingCache{ICacheInteractor: newInmemCache()}, &closingCache{ICacheInteractor: newInmemCache()}
+	c := mirror.NewCache(primary, secondary)
+	testVal := cache.CachedResponse{
+		DumpedResponse: []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"),
+		RequestURI:     "http://bxcodec.io",
+		RequestMethod:  "GET",
+		CachedTime:     time.Now(),
+	}
+	for _, key := range []string{"KEY-1", "KEY-2", "KEY-3"} {
+		if err := c.Set(key, testVal, 0); err != nil {
+			t.Fatalf("expected %v, got %v", nil, err)
+		}
+	}
+
+	// the pending writes are mirrored before the storages are closed
+	if err := c.(cache.ICloser).Close(); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	for _, key := range []string{"KEY-1", "KEY-2", "KEY-3"} {
+		if _, err := secondary.Get(key); err != nil {
+			t.Fatalf("expected %v, got %v", nil, err)
+		}
+	}
+	if primary.closed != 1 || secondary.closed != 1 {
+		t.Fatalf("expected %v, got %v and %v", 1, primary.closed, secondary.closed)
+	}
+
+	// closing again and writing afterwards don't panic, the writes are no longer mirrored
+	if err := c.(cache.ICloser).Close(); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if err := c.Set("KEY-4", testVal, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err := secondary.Get("KEY-4"); err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+}
+
+// recordingLogger keeps the logs
+type recordingLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *recordingLogger) Printf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.logs)
+}
+
+type failingCache struct {
+	cache.ICacheInteractor
+}
+
+func (failingCache) Set(key string, value cache.CachedResponse, ttl time.Duration) error {
+	return errors.New("failing")
+}
+
+func TestMirrorLogger(t *testing.T) {
+	logger := new(recordingLogger)
+	c := mirror.NewCache(newInmemCache(), failingCache{newInmemCache()}, mirror.WithLogger(logger))
+	testVal := cache.CachedResponse{
+		DumpedResponse: []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"),
+		RequestURI:     "http://bxcodec.io",
+		RequestMethod:  "GET",
+		CachedTime:     time.Now(),
+	}
+	if err := c.Set("KEY", testVal, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	eventually(t, func() bool { return logger.len() == 1 })
+}
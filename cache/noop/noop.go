@@ -0,0 +1,35 @@
+package noop
+
+import (
+	"time"
+
+	"github.com/bxcodec/httpcache/cache"
+)
+
+type noopCache struct{}
+
+// NewCache will return a cache storage that never stores anything, every Get is a miss.
+// It turns the caching off (e.g. behind a feature flag) while keeping the cache handler in the client.
+func NewCache() cache.ICacheInteractor {
+	return &noopCache{}
+}
+
+func (n *noopCache) Set(key string, value cache.CachedResponse, ttl time.Duration) error {
+	return nil
+}
+
+func (n *noopCache) Get(key string) (cache.CachedResponse, error) {
+	return cache.CachedResponse{}, cache.ErrCacheMissed
+}
+
+func (n *noopCache) Delete(key string) error {
+	return nil
+}
+
+func (n *noopCache) Flush() error {
+	return nil
+}
+
+func (n *noopCache) Origin() string {
+	return cache.CacheStorageNoop
+}
@@ -0,0 +1,35 @@
+package noop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache/cache"
+	"github.com/bxcodec/httpcache/cache/noop"
+)
+
+func TestCacheNoop(t *testing.T) {
+	cacheObj := noop.NewCache()
+	testKey := "GET http://bxcodec.io"
+	testVal := cache.CachedResponse{
+		DumpedResponse: []byte("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello"),
+		RequestURI:     "http://bxcodec.io",
+		CachedTime:     time.Now(),
+	}
+
+	if err := cacheObj.Set(testKey, testVal, time.Minute); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err := cacheObj.Get(testKey); err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+	if err := cacheObj.Delete(testKey); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if err := cacheObj.Flush(); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if origin := cacheObj.Origin(); origin != cache.CacheStorageNoop {
+		t.Fatalf("expected %v, got %v", cache.CacheStorageNoop, origin)
+	}
+}
@@ -0,0 +1,209 @@
+package record
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bxcodec/httpcache/cache"
+)
+
+// ErrUnexpectedInteraction will throw when a replayed call doesn't match the next recorded interaction
+var ErrUnexpectedInteraction = errors.New("Unexpected interaction with the replayed cache")
+
+// Interaction operations
+const (
+	OpSet    = "set"
+	OpGet    = "get"
+	OpDelete = "delete"
+	OpFlush  = "flush"
+	OpOrigin = "origin"
+)
+
+// Interaction represent a single recorded call to the cache storage
+type Interaction struct {
+	Op     string                `json:"op"`
+	Key    string                `json:"key,omitempty"`
+	Value  *cache.CachedResponse `json:"value,omitempty"` // The value passed to a Set, or returned by a Get
+	TTL    time.Duration         `json:"ttl,omitempty"`   // The ttl passed to a Set
+	Origin string                `json:"origin,omitempty"`
+	Err    string                `json:"error,omitempty"`
+}
+
+// knownErrors are restored as the same error value on replay, so the callers can still compare them
+var knownErrors = []error{
+	cache.ErrInvalidCachedResponse,
+	cache.ErrFailedToSaveToCache,
+	cache.ErrCacheMissed,
+	cache.ErrStorageInternal,
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func parseError(msg string) error {
+	if msg == "" {
+		return nil
+	}
+	for _, err := range knownErrors {
+		if err.Error() == msg {
+			return err
+		}
+	}
+	return errors.New(msg)
+}
+
+type recorder struct {
+	cache cache.ICacheInteractor
+	mu    sync.Mutex
+	enc   *json.Encoder
+}
+
+// NewRecorder will return a cache handler that writes every interaction with the given cache to w,
+// one JSON object per line. The recording can be served later with NewReplayer.
+func NewRecorder(c cache.ICacheInteractor, w io.Writer) cache.ICacheInteractor {
+	return &recorder{
+		cache: c,
+		enc:   json.NewEncoder(w),
+	}
+}
+
+func (r *recorder) record(in Interaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// a failing recording must not break the cache itself
+	_ = r.enc.Encode(in)
+}
+
+func (r *recorder) Set(key string, value cache.CachedResponse, ttl time.Duration) (err error) {
+	err = r.cache.Set(key, value, ttl)
+	r.record(Interaction{Op: OpSet, Key: key, Value: &value, TTL: ttl, Err: errorString(err)})
+	return
+}
+
+func (r *recorder) Get(key string) (res cache.CachedResponse, err error) {
+	res, err = r.cache.Get(key)
+	in := Interaction{Op: OpGet, Key: key, Err: errorString(err)}
+	if err == nil {
+		in.Value = &res
+	}
+	r.record(in)
+	return
+}
+
+func (r *recorder) Delete(key string) (err error) {
+	err = r.cache.Delete(key)
+	r.record(Interaction{Op: OpDelete, Key: key, Err: errorString(err)})
+	return
+}
+
+func (r *recorder) Flush() (err error) {
+	err = r.cache.Flush()
+	r.record(Interaction{Op: OpFlush, Err: errorString(err)})
+	return
+}
+
+func (r *recorder) Origin() (origin string) {
+	origin = r.cache.Origin()
+	r.record(Interaction{Op: OpOrigin, Origin: origin})
+	return
+}
+
+// Close will close the recorded cache, it's skipped when the cache doesn't have the capability.
+// The writer of the recording is left open, it's owned by the caller.
+func (r *recorder) Close() error {
+	if closer, ok := r.cache.(cache.ICloser); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+type replayer struct {
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+// NewReplayer will return a cache handler that serves the interactions recorded by NewRecorder.
+// The calls must happen in the recorded order, any other call returns ErrUnexpectedInteraction.
+func NewReplayer(r io.Reader) (cache.ICacheInteractor, error) {
+	res := &replayer{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		var in Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &in); err != nil {
+			return nil, fmt.Errorf("invalid recorded interaction %d: %v", len(res.interactions)+1, err)
+		}
+		res.interactions = append(res.interactions, in)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// next will pop the next interaction, it must match the given operation and key
+func (r *replayer) next(op, key string) (in Interaction, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.interactions) == 0 {
+		return in, fmt.Errorf("%w: %s %q after the end of the recording", ErrUnexpectedInteraction, op, key)
+	}
+	in = r.interactions[0]
+	if in.Op != op || in.Key != key {
+		return in, fmt.Errorf("%w: %s %q, recorded %s %q", ErrUnexpectedInteraction, op, key, in.Op, in.Key)
+	}
+	r.interactions = r.interactions[1:]
+	return in, nil
+}
+
+func (r *replayer) Set(key string, value cache.CachedResponse, ttl time.Duration) error {
+	in, err := r.next(OpSet, key)
+	if err != nil {
+		return err
+	}
+	return parseError(in.Err)
+}
+
+func (r *replayer) Get(key string) (res cache.CachedResponse, err error) {
+	in, err := r.next(OpGet, key)
+	if err != nil {
+		return
+	}
+	if in.Value != nil {
+		res = *in.Value
+	}
+	return res, parseError(in.Err)
+}
+
+func (r *replayer) Delete(key string) error {
+	in, err := r.next(OpDelete, key)
+	if err != nil {
+		return err
+	}
+	return parseError(in.Err)
+}
+
+func (r *replayer) Flush() error {
+	in, err := r.next(OpFlush, "")
+	if err != nil {
+		return err
+	}
+	return parseError(in.Err)
+}
+
+func (r *replayer) Origin() string {
+	in, err := r.next(OpOrigin, "")
+	if err != nil {
+		return ""
+	}
+	return in.Origin
+}
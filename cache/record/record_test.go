@@ -0,0 +1,117 @@
+package record_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha"
+	inmemcache "github.com/bxcodec/gotcha/cache"
+	"github.com/bxcodec/httpcache/cache"
+	"github.com/bxcodec/httpcache/cache/inmem"
+	"github.com/bxcodec/httpcache/cache/record"
+)
+
+type result struct {
+	Value  cache.CachedResponse
+	Origin string
+	Err    string
+}
+
+// session will run the same calls against the cache and collect their results
+func session(c cache.ICacheInteractor) (results []result) {
+	collect := func(value cache.CachedResponse, origin string, err error) {
+		res := result{Value: value, Origin: origin}
+		if err != nil {
+			res.Err = err.Error()
+		}
+		results = append(results, res)
+	}
+	testVal := cache.CachedResponse{
+		DumpedResponse: []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"),
+		RequestURI:     "http://bxcodec.io",
+		RequestMethod:  "GET",
+		CachedTime:     time.Date(2020, 6, 21, 13, 14, 51, 0, time.UTC),
+	}
+
+	collect(cache.CachedResponse{}, "", c.Set("KEY", testVal, 0))
+	value, err := c.Get("KEY")
+	collect(value, "", err)
+	collect(cache.CachedResponse{}, "", c.Delete("KEY"))
+	value, err = c.Get("KEY")
+	collect(value, "", err)
+	collect(cache.CachedResponse{}, c.Origin(), nil)
+	return
+}
+
+func TestRecordReplay(t *testing.T) {
+	c := gotcha.New(
+		gotcha.NewOption().SetAlgorithm(inmemcache.LRUAlgorithm).
+			SetExpiryTime(0).SetMaxSizeItem(100),
+	)
+	recording := new(bytes.Buffer)
+	recorded := session(record.NewRecorder(inmem.NewCache(c), recording))
+	if recorded[3].Err == "" {
+		t.Fatalf("expected the deleted item to be missing, got %v", recorded[3].Value)
+	}
+
+	for i := 0; i < 2; i++ {
+		replayer, err := record.NewReplayer(bytes.NewReader(recording.Bytes()))
+		if err != nil {
+			t.Fatalf("expected %v, got %v", nil, err)
+		}
+		replayed := session(replayer)
+		if !reflect.DeepEqual(recorded, replayed) {
+			t.Fatalf("expected %v, got %v", recorded, replayed)
+		}
+	}
+}
+
+func TestReplayUnexpectedInteraction(t *testing.T) {
+	recording := new(bytes.Buffer)
+	recorder := record.NewRecorder(inmem.NewCache(gotcha.New()), recording)
+	_ = recorder.Delete("KEY")
+
+	replayer, err := record.NewReplayer(recording)
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	_, err = replayer.Get("KEY")
+	if !errors.Is(err, record.ErrUnexpectedInteraction) {
+		t.Fatalf("expected %v, got %v", record.ErrUnexpectedInteraction, err)
+	}
+	if err = replayer.Delete("KEY"); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if err = replayer.Delete("KEY"); !errors.Is(err, record.ErrUnexpectedInteraction) {
+		t.Fatalf("expected %v, got %v", record.ErrUnexpectedInteraction, err)
+	}
+}
+
+type closingCache struct {
+	cache.ICacheInteractor
+	closed int
+}
+
+func (c *closingCache) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestRecorderClose(t *testing.T) {
+	c := &closingCache{ICacheInteractor: inmem.NewCache(gotcha.New())}
+	recording := new(bytes.Buffer)
+	if err := record.NewRecorder(c, recording).(cache.ICloser).Close(); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if c.closed != 1 {
+		t.Fatalf("expected %v, got %v", 1, c.closed)
+	}
+
+	// a cache without the capability is skipped
+	if err := record.NewRecorder(inmem.NewCache(gotcha.New()), recording).(cache.ICloser).Close(); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+}
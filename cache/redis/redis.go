@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/bxcodec/httpcache/cache"
@@ -15,35 +16,75 @@ type CacheOptions struct {
 	Addr     string
 	Password string
 	DB       int // 0 for default DB
+	// Namespace is the prefix of every stored key, e.g. to share a Redis database between several caches
+	Namespace string
+	// Logger receives the failures of the storage, they are discarded when nil
+	Logger cache.Logger
 }
 
 type redisCache struct {
 	ctx        context.Context
 	cache      *redis.Client
+	namespace  string
 	expiryTime time.Duration
+	logger     cache.Logger
 }
 
-// NewCache will return the redis cache handler
-func NewCache(ctx context.Context, c *redis.Client, exptime time.Duration) cache.ICacheInteractor {
-	return &redisCache{
+// Option configures the redis cache handler
+type Option func(i *redisCache)
+
+// WithLogger will send the failures of the storage to the logger, they are discarded by default
+func WithLogger(logger cache.Logger) Option {
+	return func(i *redisCache) {
+		if logger != nil {
+			i.logger = logger
+		}
+	}
+}
+
+// NewCache will return the redis cache handler. The entries are stored for the expiry time,
+// or for the ttl given to Set when it's shorter. A zero expiry time only uses the ttl.
+func NewCache(ctx context.Context, c *redis.Client, exptime time.Duration, opts ...Option) cache.ICacheInteractor {
+	return NewNamespacedCache(ctx, c, "", exptime, opts...)
+}
+
+// NewNamespacedCache will return the redis cache handler storing every key with the namespace prefix.
+// Flush and Keys only use the keys of the namespace.
+func NewNamespacedCache(ctx context.Context, c *redis.Client, namespace string, exptime time.Duration,
+	opts ...Option) cache.ICacheInteractor {
+	i := &redisCache{
 		ctx:        ctx,
 		cache:      c,
+		namespace:  namespace,
 		expiryTime: exptime,
+		logger:     cache.NopLogger{},
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// redisTTL will return the Redis TTL of a value stored for the ttl, zero to keep it without expiration
+func (i *redisCache) redisTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 || (i.expiryTime > 0 && i.expiryTime < ttl) {
+		return i.expiryTime
 	}
+	return ttl
 }
 
-func (i *redisCache) Set(key string, value cache.CachedResponse) (err error) {
+func (i *redisCache) Set(key string, value cache.CachedResponse, ttl time.Duration) (err error) {
 	valueJSON, _ := json.Marshal(value)
-	set := i.cache.Set(i.ctx, key, string(valueJSON), i.expiryTime*time.Second)
+	set := i.cache.Set(i.ctx, i.namespace+key, string(valueJSON), i.redisTTL(ttl))
 	if err := set.Err(); err != nil {
-		fmt.Println(err)
+		i.logger.Printf("Can't set the value of %q in Redis. Err: %v\n", key, err)
 		return cache.ErrStorageInternal
 	}
 	return nil
 }
 
 func (i *redisCache) Get(key string) (res cache.CachedResponse, err error) {
-	get := i.cache.Do(i.ctx, "get", key)
+	get := i.cache.Do(i.ctx, "get", i.namespace+key)
 	if err = get.Err(); err != nil {
 		if err == redis.Nil {
 			return cache.CachedResponse{}, cache.ErrCacheMissed
@@ -53,15 +94,29 @@ func (i *redisCache) Get(key string) (res cache.CachedResponse, err error) {
 	val := get.Val().(string)
 	err = json.Unmarshal([]byte(val), &res)
 	if err != nil {
-		return cache.CachedResponse{}, cache.ErrStorageInternal
+		return cache.CachedResponse{}, cache.ErrInvalidCachedResponse
 	}
 	return
 }
 
+// TTL will return the remaining lifetime of the key in Redis, zero when it's kept without expiration
+func (i *redisCache) TTL(key string) (time.Duration, error) {
+	ttl, err := i.cache.PTTL(i.ctx, i.namespace+key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	switch {
+	case ttl == -2:
+		return 0, cache.ErrCacheMissed
+	case ttl < 0:
+		return 0, nil
+	}
+	return ttl, nil
+}
+
 func (i *redisCache) Delete(key string) (err error) {
-	// deleting in redis equal to setting expiration time for key to 0
-	set := i.cache.Set(i.ctx, key, nil, 0)
-	if err := set.Err(); err != nil {
+	del := i.cache.Del(i.ctx, i.namespace+key)
+	if err := del.Err(); err != nil {
 		return cache.ErrStorageInternal
 	}
 	return nil
@@ -72,9 +127,61 @@ func (i *redisCache) Origin() string {
 }
 
 func (i *redisCache) Flush() error {
-	flush := i.cache.FlushAll(i.ctx)
-	if err := flush.Err(); err != nil {
-		return cache.ErrStorageInternal
+	if i.namespace == "" {
+		flush := i.cache.FlushAll(i.ctx)
+		if err := flush.Err(); err != nil {
+			return cache.ErrStorageInternal
+		}
+		return nil
+	}
+	// the other namespaces are kept
+	keys, err := i.Keys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := i.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *redisCache) Keys() (keys []string, err error) {
+	iter := i.cache.Scan(i.ctx, 0, escapePattern(i.namespace)+"*", 0).Iterator()
+	for iter.Next(i.ctx) {
+		keys = append(keys, strings.TrimPrefix(iter.Val(), i.namespace))
+	}
+	if err = iter.Err(); err != nil {
+		return nil, cache.ErrStorageInternal
+	}
+	return
+}
+
+func (i *redisCache) Ping(ctx context.Context) error {
+	if err := i.cache.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
+	}
+	return nil
+}
+
+// Close will close the redis client, including when it's given to NewCache
+func (i *redisCache) Close() error {
+	if err := i.cache.Close(); err != nil {
+		return fmt.Errorf("%w: %v", cache.ErrStorageInternal, err)
 	}
 	return nil
 }
+
+// escapePattern will escape the glob characters of a Redis SCAN pattern
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -2,6 +2,8 @@ package redis_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -23,7 +25,7 @@ func TestCacheRedis(t *testing.T) {
 		DB:       0,  // use default DB
 	})
 
-	cacheObj := rediscache.NewCache(context.Background(), c, 15)
+	cacheObj := rediscache.NewCache(context.Background(), c, time.Second*15)
 	testKey := "KEY"
 	testVal := cache.CachedResponse{
 		DumpedResponse: nil,
@@ -33,7 +35,7 @@ func TestCacheRedis(t *testing.T) {
 	}
 
 	// Try to SET item
-	err = cacheObj.Set(testKey, testVal)
+	err = cacheObj.Set(testKey, testVal, 0)
 	if err != nil {
 		t.Fatalf("expected %v, got %v", nil, err)
 	}
@@ -64,3 +66,211 @@ func TestCacheRedis(t *testing.T) {
 		t.Fatalf("expected %v, got %v", err, nil)
 	}
 }
+
+func TestCacheRedisKeys(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+	c := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	cacheObj := rediscache.NewCache(context.Background(), c, time.Second*15)
+	for _, key := range []string{"KEY-1", "KEY-2"} {
+		err = cacheObj.Set(key, cache.CachedResponse{RequestMethod: "GET", CachedTime: time.Now()}, 0)
+		if err != nil {
+			t.Fatalf("expected %v, got %v", nil, err)
+		}
+	}
+	err = cacheObj.Delete("KEY-1")
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+
+	keys, err := cacheObj.(cache.IKeyLister).Keys()
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if len(keys) != 1 || keys[0] != "KEY-2" {
+		t.Fatalf("expected %v, got %v", []string{"KEY-2"}, keys)
+	}
+}
+
+func TestCacheRedisPing(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	c := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	cacheObj := rediscache.NewCache(context.Background(), c, time.Second*15).(cache.IPinger)
+	err = cacheObj.Ping(context.Background())
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+
+	s.Close()
+	err = cacheObj.Ping(context.Background())
+	if !errors.Is(err, cache.ErrStorageInternal) {
+		t.Fatalf("expected %v, got %v", cache.ErrStorageInternal, err)
+	}
+}
+
+func TestCacheRedisClose(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+	c := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	cacheObj := rediscache.NewCache(context.Background(), c, time.Second*15)
+	if err = cacheObj.(cache.ICloser).Close(); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	// the client is closed
+	if err = cacheObj.(cache.IPinger).Ping(context.Background()); !errors.Is(err, cache.ErrStorageInternal) {
+		t.Fatalf("expected %v, got %v", cache.ErrStorageInternal, err)
+	}
+}
+
+func TestCacheRedisNamespace(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+	c := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	first := rediscache.NewNamespacedCache(context.Background(), c, "first:", time.Minute)
+	second := rediscache.NewNamespacedCache(context.Background(), c, "second:", time.Minute)
+	testVal := cache.CachedResponse{RequestMethod: "GET", RequestURI: "http://bxcodec.io", CachedTime: time.Now()}
+	if err = first.Set("KEY", testVal, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if !s.Exists("first:KEY") {
+		t.Fatalf("expected %v, got %v", s.Keys(), []string{"first:KEY"})
+	}
+	if _, err = second.Get("KEY"); err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+	if err = second.Set("KEY", testVal, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+
+	keys, err := first.(cache.IKeyLister).Keys()
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if len(keys) != 1 || keys[0] != "KEY" {
+		t.Fatalf("expected %v, got %v", []string{"KEY"}, keys)
+	}
+
+	// the flush only removes its own namespace
+	if err = first.Flush(); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err = first.Get("KEY"); err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+	if _, err = second.Get("KEY"); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+}
+
+func TestCacheRedisTTL(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+	c := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	cacheObj := rediscache.NewCache(context.Background(), c, time.Hour)
+	testVal := cache.CachedResponse{RequestMethod: "GET", RequestURI: "http://bxcodec.io", CachedTime: time.Now()}
+	if err = cacheObj.Set("NO-EXPIRATION", testVal, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if ttl := s.TTL("NO-EXPIRATION"); ttl != time.Hour {
+		t.Fatalf("expected %v, got %v", time.Hour, ttl)
+	}
+
+	// stored for its ttl
+	if err = cacheObj.Set("TTL", testVal, time.Minute); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if ttl := s.TTL("TTL"); ttl != time.Minute {
+		t.Fatalf("expected %v, got %v", time.Minute, ttl)
+	}
+	if ttl, err := cacheObj.(cache.ITTLReporter).TTL("TTL"); err != nil || ttl != time.Minute {
+		t.Fatalf("expected %v, got %v and %v", time.Minute, ttl, err)
+	}
+	if _, err := cacheObj.(cache.ITTLReporter).TTL("MISSING"); err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+
+	// the expiry time still caps it
+	if err = cacheObj.Set("LONG-TTL", testVal, time.Hour*2); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if ttl := s.TTL("LONG-TTL"); ttl != time.Hour {
+		t.Fatalf("expected %v, got %v", time.Hour, ttl)
+	}
+}
+
+type recordingLogger []string
+
+func (l *recordingLogger) Printf(format string, args ...interface{}) {
+	*l = append(*l, fmt.Sprintf(format, args...))
+}
+
+func TestCacheRedisLogger(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	c := redis.NewClient(&redis.Options{
+		Addr:       s.Addr(),
+		MaxRetries: -1,
+	})
+	logger := new(recordingLogger)
+	cacheObj := rediscache.NewCache(context.Background(), c, time.Minute, rediscache.WithLogger(logger))
+
+	// the failures are logged to the given logger
+	s.Close()
+	if err := cacheObj.Set("KEY", cache.CachedResponse{RequestURI: "http://bxcodec.io"}, 0); err != cache.ErrStorageInternal {
+		t.Fatalf("expected %v, got %v", cache.ErrStorageInternal, err)
+	}
+	if len(*logger) != 1 {
+		t.Fatalf("expected %v, got %v", 1, *logger)
+	}
+}
+
+func TestCacheRedisCorrupted(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+	c := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	cacheObj := rediscache.NewCache(context.Background(), c, time.Second*15)
+	if err = s.Set("KEY", `{"response":`); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err = cacheObj.Get("KEY"); err != cache.ErrInvalidCachedResponse {
+		t.Fatalf("expected %v, got %v", cache.ErrInvalidCachedResponse, err)
+	}
+}
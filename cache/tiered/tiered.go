@@ -0,0 +1,79 @@
+package tiered
+
+import (
+	"time"
+
+	"github.com/bxcodec/httpcache/cache"
+)
+
+type tieredCache struct {
+	l1 cache.ICacheInteractor
+	l2 cache.ICacheInteractor
+}
+
+// NewCache will return a cache storage reading the l1 storage (e.g. in memory) before the l2 one (e.g. a shared
+// Redis). An entry only found in the l2 storage is promoted to the l1 storage, with its expiration (see
+// cache.RemainingTTL), it's not promoted when its expiration is unknown. The writes go through both storages,
+// so the l2 storage always has the entries of the l1 one.
+func NewCache(l1, l2 cache.ICacheInteractor) cache.ICacheInteractor {
+	return &tieredCache{
+		l1: l1,
+		l2: l2,
+	}
+}
+
+func (t *tieredCache) Set(key string, value cache.CachedResponse, ttl time.Duration) (err error) {
+	if err = t.l2.Set(key, value, ttl); err != nil {
+		return
+	}
+	return t.l1.Set(key, value, ttl)
+}
+
+func (t *tieredCache) Get(key string) (res cache.CachedResponse, err error) {
+	if res, err = t.l1.Get(key); err == nil {
+		return
+	}
+	if res, err = t.l2.Get(key); err != nil {
+		return
+	}
+	ttl, ok := cache.RemainingTTL(t.l2, key, res)
+	if !ok {
+		return // already expired, or a promoted entry could outlive it
+	}
+	// a failed promotion is only a slower next read
+	_ = t.l1.Set(key, res, ttl)
+	return
+}
+
+func (t *tieredCache) Delete(key string) (err error) {
+	// deleted from the l2 storage first, so a concurrent Get can't promote the entry back
+	err = t.l2.Delete(key)
+	if errL1 := t.l1.Delete(key); err == nil {
+		err = errL1
+	}
+	return
+}
+
+func (t *tieredCache) Flush() (err error) {
+	err = t.l2.Flush()
+	if errL1 := t.l1.Flush(); err == nil {
+		err = errL1
+	}
+	return
+}
+
+// Close will close both storages, the ones without the capability are skipped
+func (t *tieredCache) Close() (err error) {
+	for _, store := range []cache.ICacheInteractor{t.l2, t.l1} {
+		if closer, ok := store.(cache.ICloser); ok {
+			if errClose := closer.Close(); err == nil {
+				err = errClose
+			}
+		}
+	}
+	return
+}
+
+func (t *tieredCache) Origin() string {
+	return cache.CacheStorageTiered
+}
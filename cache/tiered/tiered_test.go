@@ -0,0 +1,167 @@
+package tiered_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha"
+	inmemcache "github.com/bxcodec/gotcha/cache"
+	"github.com/bxcodec/httpcache/cache"
+	"github.com/bxcodec/httpcache/cache/inmem"
+	"github.com/bxcodec/httpcache/cache/tiered"
+	"github.com/bxcodec/httpcache/mocks"
+)
+
+func newInmemCache() cache.ICacheInteractor {
+	return inmem.NewCache(gotcha.New(
+		gotcha.NewOption().SetAlgorithm(inmemcache.LRUAlgorithm).SetExpiryTime(time.Minute).SetMaxSizeItem(100),
+	))
+}
+
+var testVal = cache.CachedResponse{
+	DumpedResponse: []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"),
+	RequestURI:     "http://bxcodec.io",
+	RequestMethod:  "GET",
+	CachedTime:     time.Now(),
+}
+
+func TestTieredWriteThrough(t *testing.T) {
+	l1, l2 := newInmemCache(), newInmemCache()
+	c := tiered.NewCache(l1, l2)
+
+	if err := c.Set("KEY", testVal, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	for _, store := range []cache.ICacheInteractor{l1, l2} {
+		if _, err := store.Get("KEY"); err != nil {
+			t.Fatalf("expected %v, got %v", nil, err)
+		}
+	}
+
+	if err := c.Delete("KEY"); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	for _, store := range []cache.ICacheInteractor{l1, l2, c} {
+		if _, err := store.Get("KEY"); err != cache.ErrCacheMissed {
+			t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+		}
+	}
+}
+
+func TestTieredPromotion(t *testing.T) {
+	l1, l2 := newInmemCache(), newInmemCache()
+	c := tiered.NewCache(l1, l2)
+
+	// only in the l2 storage, e.g. stored by another process
+	value := testVal
+	value.ExpiresAt = time.Now().Add(time.Minute)
+	if err := l2.Set("KEY", value, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	res, err := c.Get("KEY")
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if res.RequestURI != testVal.RequestURI {
+		t.Fatalf("expected %v, got %v", testVal.RequestURI, res.RequestURI)
+	}
+
+	// promoted with its expiration
+	promoted, err := l1.Get("KEY")
+	if err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if !promoted.ExpiresAt.Equal(value.ExpiresAt) {
+		t.Fatalf("expected %v, got %v", value.ExpiresAt, promoted.ExpiresAt)
+	}
+
+	// and served from the l1 storage
+	if err = l2.Delete("KEY"); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err = c.Get("KEY"); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+
+	// the expired entries are not promoted
+	value.ExpiresAt = time.Now().Add(-time.Second)
+	if err = l2.Set("EXPIRED", value, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err = c.Get("EXPIRED"); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err = l1.Get("EXPIRED"); err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+
+	// without ExpiresAt, the promoted entry gets the remaining ttl of the l2 one
+	if err = l2.Set("TTL", testVal, time.Minute); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err = c.Get("TTL"); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if ttl, err := l1.(cache.ITTLReporter).TTL("TTL"); err != nil || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("expected a remaining ttl, got %v and %v", ttl, err)
+	}
+
+	// and when the l2 storage can't report it, the entry is served without being promoted
+	c = tiered.NewCache(l1, struct{ cache.ICacheInteractor }{l2})
+	if err = l2.Set("UNKNOWN-TTL", testVal, time.Minute); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err = c.Get("UNKNOWN-TTL"); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err = l1.Get("UNKNOWN-TTL"); err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+}
+
+func TestTieredFlush(t *testing.T) {
+	l1, l2 := newInmemCache(), newInmemCache()
+	c := tiered.NewCache(l1, l2)
+	if err := c.Set("KEY", testVal, 0); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if _, err := c.Get("KEY"); err != cache.ErrCacheMissed {
+		t.Fatalf("expected %v, got %v", cache.ErrCacheMissed, err)
+	}
+	if c.Origin() != cache.CacheStorageTiered {
+		t.Fatalf("expected %v, got %v", cache.CacheStorageTiered, c.Origin())
+	}
+}
+
+// closingCache is a storage counting its Close calls
+type closingCache struct {
+	cache.ICacheInteractor
+	closed int
+}
+
+func (c *closingCache) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestTieredClose(t *testing.T) {
+	l1, l2 := &closingCache{ICacheInteractor: newInmemCache()}, &closingCache{ICacheInteractor: newInmemCache()}
+	if err := tiered.NewCache(l1, l2).(cache.ICloser).Close(); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if l1.closed != 1 || l2.closed != 1 {
+		t.Fatalf("expected %v, got %v and %v", 1, l1.closed, l2.closed)
+	}
+
+	// a storage without the capability is skipped
+	l1.closed = 0
+	if err := tiered.NewCache(l1, new(mocks.ICacheInteractor)).(cache.ICloser).Close(); err != nil {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if l1.closed != 1 {
+		t.Fatalf("expected %v, got %v", 1, l1.closed)
+	}
+}
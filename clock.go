@@ -0,0 +1,11 @@
+package httpcache
+
+import "time"
+
+// now will return the current time of the Clock, used by every freshness computation
+func (r *CacheHandler) now() time.Time {
+	if r.Clock != nil {
+		return r.Clock()
+	}
+	return time.Now()
+}
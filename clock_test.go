@@ -0,0 +1,55 @@
+package httpcache_test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a time only moving when it's advanced
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func TestClock(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=60")
+	defer server.Close()
+	clock := &fakeClock{now: time.Now()}
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.Clock = clock.Now
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, client, req)
+
+	// still fresh at its max-age
+	clock.Advance(time.Minute)
+	resp, body := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "60", resp.Header.Get(httpcache.HeaderAge))
+	require.Equal(t, "1", body)
+
+	// and stale right after it
+	clock.Advance(time.Nanosecond)
+	resp, body = doRequest(t, client, req)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "2", body)
+	require.EqualValues(t, 2, *hits)
+}
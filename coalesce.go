@@ -0,0 +1,112 @@
+package httpcache
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/bxcodec/httpcache/cache"
+)
+
+// sharedResponse is the buffered response of a coalesced fetch, copied for every waiting request
+type sharedResponse struct {
+	resp     *http.Response // its body is already read, unless it's not shareable
+	body     []byte
+	req      *http.Request
+	unshared bool // the response is only returned to its request, the others fetch on their own
+}
+
+// coalesce will run the fetch once for the concurrent requests of the key when RequestCoalescing is set,
+// the others wait for it and get a copy of its response. The requests with a Range or a validator
+// get a response specific to them, they are never coalesced. Only a response that could be stored (within
+// MaxBodyBytes) is shared, e.g. the one with a Set-Cookie or a private one is specific to its request.
+func (r *CacheHandler) coalesce(key string, req *http.Request, fetch func() (*http.Response, error)) (*http.Response, error) {
+	if !r.RequestCoalescing || req.Header.Get("Range") != "" || isConditional(req) {
+		return fetch()
+	}
+	val, err, shared := r.flights.Do(key, func() (interface{}, error) {
+		resp, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		if !r.shareable(req, resp) {
+			return &sharedResponse{resp: resp, req: req, unshared: true}, nil
+		}
+		body, read, err := r.readShared(resp)
+		if err != nil {
+			return nil, err
+		}
+		if !read {
+			return &sharedResponse{resp: resp, req: req, unshared: true}, nil
+		}
+		return &sharedResponse{resp: resp, body: body, req: req}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := val.(*sharedResponse)
+	if res.unshared {
+		if res.req == req {
+			return res.resp, nil
+		}
+		return fetch()
+	}
+	if shared && res.req != req && !r.sameVariant(res.resp.Header, res.req, req) {
+		// the response varies on a header the requests don't share
+		return fetch()
+	}
+	return res.copy(req), nil
+}
+
+// shareable will check if the response of the request can be given to the other requests of the key,
+// with the same checks as its storage (RFC 7234 ones included, even when ComplyRFC is not set)
+func (r *CacheHandler) shareable(req *http.Request, resp *http.Response) bool {
+	return r.storable(req, resp) && r.validateStorable(req, resp) == nil
+}
+
+// readShared will read the body of the response to share it, it's not read (false) when it's larger than
+// MaxBodyBytes: the read part is then put back in front of the body.
+func (r *CacheHandler) readShared(resp *http.Response) (body []byte, read bool, err error) {
+	if r.MaxBodyBytes <= 0 {
+		defer resp.Body.Close()
+		body, err = ioutil.ReadAll(resp.Body)
+		return body, err == nil, err
+	}
+	if resp.ContentLength > r.MaxBodyBytes {
+		return nil, false, nil
+	}
+	body, err = ioutil.ReadAll(io.LimitReader(resp.Body, r.MaxBodyBytes+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, false, err
+	}
+	if int64(len(body)) > r.MaxBodyBytes {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return nil, false, nil
+	}
+	resp.Body.Close()
+	return body, true, nil
+}
+
+// sameVariant will check if the request selects the same variant of the response (with the header) as the
+// request it answered
+func (r *CacheHandler) sameVariant(header http.Header, answered, req *http.Request) bool {
+	names, all := varyNames(header)
+	if all {
+		return false
+	}
+	return r.matchVary(cache.CachedResponse{VaryHeaders: r.varyValues(names, answered)}, req)
+}
+
+// copy will return a copy of the response with its own body reader, for the request
+func (s *sharedResponse) copy(req *http.Request) *http.Response {
+	resp := *s.resp
+	resp.Header = s.resp.Header.Clone()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(s.body))
+	resp.Request = req
+	return &resp
+}
@@ -0,0 +1,136 @@
+package httpcache_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestCoalescing(t *testing.T) {
+	var hits int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit := atomic.AddInt64(&hits, 1)
+		time.Sleep(time.Millisecond * 200)
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.WriteHeader(http.StatusOK)
+		_, err := fmt.Fprintf(w, "%d", hit)
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.RequestCoalescing = true
+	client := &http.Client{Transport: handler}
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 50)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			require.NoError(t, err)
+			_, bodies[i] = doRequest(t, client, req)
+		}(i)
+	}
+	wg.Wait()
+
+	require.EqualValues(t, 1, atomic.LoadInt64(&hits))
+	for _, body := range bodies {
+		require.Equal(t, "1", body)
+	}
+}
+
+func TestRequestCoalescingVary(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 100)
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Vary", "Accept-Language")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(r.Header.Get("Accept-Language")))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.RequestCoalescing = true
+	client := &http.Client{Transport: handler}
+
+	// the languages don't share their response, even when they are coalesced
+	var wg sync.WaitGroup
+	languages := []string{"en", "fr", "en", "fr"}
+	bodies := make([]string, len(languages))
+	for i, language := range languages {
+		wg.Add(1)
+		go func(i int, language string) {
+			defer wg.Done()
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			require.NoError(t, err)
+			req.Header.Set("Accept-Language", language)
+			_, bodies[i] = doRequest(t, client, req)
+		}(i, language)
+	}
+	wg.Wait()
+	require.Equal(t, languages, bodies)
+}
+
+func TestRequestCoalescingNotShareable(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		header       http.Header
+		maxBodyBytes int64
+	}{
+		{"set-cookie", http.Header{"Cache-Control": {"max-age=3600"}, "Set-Cookie": {"session=1"}}, 0},
+		{"private", http.Header{"Cache-Control": {"private, max-age=3600"}}, 0},
+		{"no-store", http.Header{"Cache-Control": {"no-store"}}, 0},
+		{"larger than MaxBodyBytes", http.Header{"Cache-Control": {"max-age=3600"}}, 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var hits int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hit := atomic.AddInt64(&hits, 1)
+				time.Sleep(time.Millisecond * 200)
+				for name, values := range tc.header {
+					w.Header()[name] = values
+				}
+				w.WriteHeader(http.StatusOK)
+				// without Content-Length, its size is only known once read
+				w.(http.Flusher).Flush()
+				_, err := fmt.Fprintf(w, "response %d", hit)
+				require.NoError(t, err)
+			}))
+			defer server.Close()
+			handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+			handler.Shared = true
+			handler.RequestCoalescing = true
+			handler.MaxBodyBytes = tc.maxBodyBytes
+			client := &http.Client{Transport: handler}
+
+			// every request gets its own response
+			var wg sync.WaitGroup
+			bodies := make([]string, 5)
+			for i := range bodies {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+					require.NoError(t, err)
+					_, bodies[i] = doRequest(t, client, req)
+				}(i)
+			}
+			wg.Wait()
+			require.EqualValues(t, len(bodies), atomic.LoadInt64(&hits))
+			seen := map[string]bool{}
+			for _, body := range bodies {
+				require.Contains(t, body, "response ")
+				seen[body] = true
+			}
+			require.Len(t, seen, len(bodies))
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package httpcache
+
+import (
+	"net/http"
+	"net/http/httputil"
+
+	"github.com/bxcodec/httpcache/cache"
+)
+
+// dumpResponse will dump the response to be stored, without its hop-by-hop headers, and without the headers
+// restored on replay when CompactHeaders is set
+func (r *CacheHandler) dumpResponse(resp *http.Response) ([]byte, error) {
+	header, closing := resp.Header, resp.Close
+	defer func() { resp.Header, resp.Close = header, closing }()
+
+	stored := withoutHopByHop(header)
+	// the origin connection is closed, not the connections the response is replayed on
+	resp.Close = false
+	if r.CompactHeaders {
+		// recomputed from the cached time on replay
+		stored.Del("Date")
+		for name, values := range r.HeaderBaseline {
+			if equalHeaderValues(stored[http.CanonicalHeaderKey(name)], values) {
+				stored.Del(name)
+			}
+		}
+	}
+	resp.Header = stored
+	return httputil.DumpResponse(resp, true)
+}
+
+// expandHeader will restore the headers omitted by dumpResponse
+func (r *CacheHandler) expandHeader(header http.Header, cachedResp cache.CachedResponse) {
+	if !r.CompactHeaders {
+		return
+	}
+	if header.Get("Date") == "" {
+		header.Set("Date", cachedResp.CachedTime.UTC().Format(http.TimeFormat))
+	}
+	for name, values := range r.HeaderBaseline {
+		key := http.CanonicalHeaderKey(name)
+		if _, ok := header[key]; !ok {
+			header[key] = append([]string(nil), values...)
+		}
+	}
+}
+
+func equalHeaderValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package httpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/bxcodec/httpcache/cache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Server", "origin/1.0")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(`{}`))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	storedEntry := func(c cache.ICacheInteractor) cache.CachedResponse {
+		keys, err := c.(cache.IKeyLister).Keys()
+		require.NoError(t, err)
+		require.Len(t, keys, 1)
+		entry, err := c.Get(keys[0])
+		require.NoError(t, err)
+		return entry
+	}
+
+	plainCache := newInmemCache()
+	plainHandler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, plainCache)
+	origin, _ := doRequest(t, &http.Client{Transport: plainHandler}, req)
+
+	compactCache := newInmemCache()
+	compactHandler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, compactCache)
+	compactHandler.CompactHeaders = true
+	compactHandler.HeaderBaseline = http.Header{
+		"Content-Type":           {"application/json"},
+		"Server":                 {"origin/1.0"},
+		"X-Content-Type-Options": {"nosniff"},
+	}
+	client := &http.Client{Transport: compactHandler}
+	doRequest(t, client, req)
+	require.Less(t, len(storedEntry(compactCache).DumpedResponse), len(storedEntry(plainCache).DumpedResponse))
+
+	resp, body := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, `{}`, body)
+	for _, name := range []string{"Cache-Control", "Content-Type", "Server", "X-Content-Type-Options", "ETag"} {
+		require.Equal(t, origin.Header[name], resp.Header[name], name)
+	}
+	originDate, err := http.ParseTime(origin.Header.Get("Date"))
+	require.NoError(t, err)
+	replayDate, err := http.ParseTime(resp.Header.Get("Date"))
+	require.NoError(t, err)
+	require.WithinDuration(t, originDate, replayDate, time.Second*2)
+}
@@ -0,0 +1,129 @@
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/bxcodec/httpcache/cache"
+)
+
+// Compression codecs, see CacheHandler.CompressionCodec
+const (
+	CodecNone   = ""
+	CodecGzip   = "gzip"
+	CodecBrotli = "br"
+)
+
+// minCompressedSize is the size of the smallest compressed dumped response, the smaller ones hardly shrink
+const minCompressedSize = 512
+
+// defaultCompressibleTypes are the CompressibleTypes when it's nil
+var defaultCompressibleTypes = []string{
+	"text/", "+json", "+xml", "application/json", "application/javascript", "application/xml",
+	"application/x-www-form-urlencoded", "image/svg+xml",
+}
+
+// compressible will check if the dumped response is worth compressing, from its size and its headers
+func (r *CacheHandler) compressible(dumped []byte) bool {
+	if len(dumped) < minCompressedSize {
+		return false
+	}
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(dumped)))
+	if _, err := reader.ReadLine(); err != nil {
+		return false
+	}
+	header, err := reader.ReadMIMEHeader()
+	if err != nil {
+		return false
+	}
+	if encoding := http.Header(header).Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return false // already compressed
+	}
+	mediaType, _, err := mime.ParseMediaType(http.Header(header).Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	types := r.CompressibleTypes
+	if types == nil {
+		types = defaultCompressibleTypes
+	}
+	for _, compressible := range types {
+		compressible = strings.ToLower(compressible)
+		switch {
+		case strings.HasSuffix(compressible, "/") && strings.HasPrefix(mediaType, compressible),
+			strings.HasPrefix(compressible, "+") && strings.HasSuffix(mediaType, compressible),
+			mediaType == compressible:
+			return true
+		}
+	}
+	return false
+}
+
+// compressEntry will compress the dumped response of the entry with the CompressionCodec when Compression is
+// set, and the response is compressible (see CompressibleTypes). The entries stored compressed are flagged with
+// their codec, so they are read back whatever the Compression.
+func (r *CacheHandler) compressEntry(entry cache.CachedResponse) (cache.CachedResponse, error) {
+	if !r.Compression || entry.Compressed || !r.compressible(entry.DumpedResponse) {
+		return entry, nil
+	}
+	codec := r.CompressionCodec
+	if codec == CodecNone {
+		codec = CodecGzip
+	}
+	var compressed bytes.Buffer
+	var writer io.WriteCloser
+	switch codec {
+	case CodecGzip:
+		writer = gzip.NewWriter(&compressed)
+	case CodecBrotli:
+		writer = brotli.NewWriter(&compressed)
+	default:
+		return entry, fmt.Errorf("unknown compression codec %q", codec)
+	}
+	if _, err := writer.Write(entry.DumpedResponse); err != nil {
+		return entry, err
+	}
+	if err := writer.Close(); err != nil {
+		return entry, err
+	}
+	entry.DumpedResponse, entry.Compressed, entry.Codec = compressed.Bytes(), true, codec
+	return entry, nil
+}
+
+// dumpedResponse will return the dumped response of the stored entry, decompressed when it's compressed
+func dumpedResponse(entry cache.CachedResponse) ([]byte, error) {
+	if !entry.Compressed {
+		return entry.DumpedResponse, nil
+	}
+	switch entry.Codec {
+	case CodecNone, CodecGzip: // the entries compressed before the codecs are gzipped
+		reader, err := gzip.NewReader(bytes.NewReader(entry.DumpedResponse))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return ioutil.ReadAll(reader)
+	case CodecBrotli:
+		return ioutil.ReadAll(brotli.NewReader(bytes.NewReader(entry.DumpedResponse)))
+	}
+	return nil, fmt.Errorf("unknown compression codec %q", entry.Codec)
+}
+
+// decompressEntry will return the entry with its dumped response decompressed
+func decompressEntry(entry cache.CachedResponse) (cache.CachedResponse, error) {
+	dumped, err := dumpedResponse(entry)
+	if err != nil {
+		return entry, err
+	}
+	entry.DumpedResponse, entry.Compressed, entry.Codec = dumped, false, CodecNone
+	return entry, nil
+}
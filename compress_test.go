@@ -0,0 +1,215 @@
+package httpcache_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/bxcodec/httpcache/cache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompression(t *testing.T) {
+	items := make([]map[string]interface{}, 1000)
+	for i := range items {
+		items[i] = map[string]interface{}{"id": i, "name": "product", "description": "a text-heavy description"}
+	}
+	payload, err := json.Marshal(items)
+	require.NoError(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write(payload)
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+
+	storedSize := func(compression bool) int {
+		handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+		handler.Compression = compression
+		client := &http.Client{Transport: handler}
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+
+		doRequest(t, client, req)
+		resp, body := doRequest(t, client, req)
+		require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+		require.Equal(t, string(payload), body)
+
+		entries := listDebugEntries(t, httpcache.DebugHandler(handler))
+		require.Len(t, entries, 1)
+		return entries[0].Size
+	}
+	plain, compressed := storedSize(false), storedSize(true)
+	require.Greater(t, plain, len(payload))
+	require.Less(t, compressed, plain/10)
+}
+
+func TestCompressionMixedEntries(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	plain, err := http.NewRequest(http.MethodGet, server.URL+"/plain", nil)
+	require.NoError(t, err)
+	compressed, err := http.NewRequest(http.MethodGet, server.URL+"/compressed", nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, plain)
+	handler.Compression = true
+	doRequest(t, client, compressed)
+
+	// both are served whatever the Compression
+	for _, compression := range []bool{true, false} {
+		handler.Compression = compression
+		resp, body := doRequest(t, client, plain)
+		require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+		require.Equal(t, "1", body)
+		resp, body = doRequest(t, client, compressed)
+		require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+		require.Equal(t, "2", body)
+	}
+	require.EqualValues(t, 2, *hits)
+}
+
+func TestCompressionBrotli(t *testing.T) {
+	items := make([]map[string]interface{}, 1000)
+	for i := range items {
+		items[i] = map[string]interface{}{"id": i, "name": "product", "description": "a text-heavy description"}
+	}
+	payload, err := json.Marshal(items)
+	require.NoError(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write(payload)
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+
+	storedSize := func(codec string) int {
+		handler := httpcache.New(newInmemCache(), httpcache.WithCompression(codec))
+		client := &http.Client{Transport: handler}
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+
+		doRequest(t, client, req)
+		resp, body := doRequest(t, client, req)
+		require.True(t, httpcache.FromCache(resp))
+		require.Equal(t, string(payload), body)
+
+		entries := listDebugEntries(t, httpcache.DebugHandler(handler))
+		require.Len(t, entries, 1)
+		return entries[0].Size
+	}
+	plain, gzipped, brotli := storedSize(httpcache.CodecNone), storedSize(httpcache.CodecGzip), storedSize(httpcache.CodecBrotli)
+	require.Less(t, brotli, plain/10)
+	require.Less(t, brotli, gzipped)
+}
+
+func TestCompressionMixedCodecs(t *testing.T) {
+	var hits int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Content-Type", "text/plain")
+		_, err := fmt.Fprintf(w, "%d %s", hits, strings.Repeat("text ", 200))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	handler := httpcache.New(newInmemCache())
+	client := &http.Client{Transport: handler}
+	codecs := []string{httpcache.CodecNone, httpcache.CodecGzip, httpcache.CodecBrotli}
+	reqs := make([]*http.Request, len(codecs))
+	for i, codec := range codecs {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/"+codec, nil)
+		require.NoError(t, err)
+		httpcache.WithCompression(codec)(handler)
+		doRequest(t, client, req)
+		reqs[i] = req
+	}
+
+	// the entries of every codec are served during a migration, whatever the current one
+	for _, codec := range codecs {
+		httpcache.WithCompression(codec)(handler)
+		for i, req := range reqs {
+			resp, body := doRequest(t, client, req)
+			require.True(t, httpcache.FromCache(resp))
+			require.Equal(t, strconv.Itoa(i+1)+" "+strings.Repeat("text ", 200), body)
+		}
+	}
+	require.EqualValues(t, 3, hits)
+}
+
+func TestCompressibleTypes(t *testing.T) {
+	text := strings.Repeat("compressible ", 200)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		if encoding := r.URL.Query().Get("encoding"); encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		body := text
+		if r.URL.Query().Get("tiny") != "" {
+			body = "tiny"
+		}
+		_, err := w.Write([]byte(body))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	storage := newInmemCache()
+	handler := httpcache.New(storage, httpcache.WithCompression(httpcache.CodecGzip))
+	client := &http.Client{Transport: handler}
+
+	tests := map[string]bool{
+		"?type=application/json":             true,
+		"?type=text/html%3B+charset=utf-8":   true,
+		"?type=application/problem%2Bjson":   true,
+		"?type=image/jpeg":                   false,
+		"?type=application/json&encoding=br": false,
+		"?type=application/json&tiny=1":      false,
+		"?type=application/octet-stream":     false,
+		"?type=text/plain&encoding=identity": true,
+	}
+	for query, compressed := range tests {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/"+query, nil)
+		require.NoError(t, err)
+		doRequest(t, client, req)
+		resp, _ := doRequest(t, client, req)
+		require.True(t, httpcache.FromCache(resp), query)
+
+		keys, err := storage.(cache.IKeyLister).Keys()
+		require.NoError(t, err)
+		var found bool
+		for _, key := range keys {
+			entry, err := storage.Get(key)
+			require.NoError(t, err)
+			if entry.RequestURI == req.URL.String() {
+				found = true
+				require.Equal(t, compressed, entry.Compressed, query)
+			}
+		}
+		require.True(t, found, query)
+	}
+
+	// the list replaces the default one
+	handler.CompressibleTypes = []string{"image/"}
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/custom?type=image/bmp", nil)
+	require.NoError(t, err)
+	doRequest(t, client, req)
+	keys, err := storage.(cache.IKeyLister).Keys()
+	require.NoError(t, err)
+	var found bool
+	for _, key := range keys {
+		if entry, err := storage.Get(key); err == nil && entry.RequestURI == req.URL.String() {
+			found = true
+			require.True(t, entry.Compressed)
+		}
+	}
+	require.True(t, found)
+}
@@ -0,0 +1,30 @@
+package httpcache
+
+import (
+	"net/http"
+)
+
+// contentLocationKey will return the secondary cache key of a response with a Content-Location header
+// (RFC 7234 section 4.1), or an empty string when there is none. Only a Content-Location of the same origin
+// as the request is used, so an origin can't write the entries of another host.
+func (r *CacheHandler) contentLocationKey(req *http.Request, resp *http.Response) string {
+	if !r.ContentLocationKeying || req.Method != http.MethodGet ||
+		resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return ""
+	}
+	location := resp.Header.Get("Content-Location")
+	if location == "" {
+		return ""
+	}
+	target, err := req.URL.Parse(location)
+	if err != nil || target.Scheme != req.URL.Scheme || target.Host != req.URL.Host {
+		return ""
+	}
+	locationReq, err := http.NewRequestWithContext(req.Context(), http.MethodGet, target.String(), nil)
+	if err != nil {
+		return ""
+	}
+	// the secondary entry must be keyed like the request it answers for
+	locationReq.Header = req.Header
+	return r.cacheKey(locationReq)
+}
@@ -0,0 +1,42 @@
+package httpcache_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentLocationKeying(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Content-Location", "/products/123")
+		w.WriteHeader(http.StatusOK)
+		_, err := fmt.Fprintf(w, "%d", hits)
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.ContentLocationKeying = true
+	client := &http.Client{Transport: handler}
+
+	original, err := http.NewRequest(http.MethodGet, server.URL+"/products/latest", nil)
+	require.NoError(t, err)
+	location, err := http.NewRequest(http.MethodGet, server.URL+"/products/123", nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, original)
+	resp, body := doRequest(t, client, original)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "1", body)
+
+	resp, body = doRequest(t, client, location)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "1", body)
+	require.Equal(t, 1, hits)
+}
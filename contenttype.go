@@ -0,0 +1,44 @@
+package httpcache
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// acceptsContentType will check if the media type is acceptable for the Accept header of a request.
+// An absent Accept header, or an absent or unparseable Content-Type, accepts anything.
+func acceptsContentType(accept, contentType string) bool {
+	if strings.TrimSpace(accept) == "" || contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return true
+	}
+	for _, mediaRange := range strings.Split(accept, ",") {
+		acceptedType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			// q=0 means not acceptable
+			continue
+		}
+		if matchMediaRange(acceptedType, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMediaRange will check if the media type is in the media range, e.g. "text/*"
+func matchMediaRange(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	if strings.HasSuffix(mediaRange, "/*") {
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*"))
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package httpcache_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckContentType(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		// misconfigured, the type doesn't depend on the Accept header and there's no Vary
+		if hits == 1 {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.WriteHeader(http.StatusOK)
+		_, err := fmt.Fprintf(w, "%d", hits)
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.CheckContentType = true
+	client := &http.Client{Transport: handler}
+
+	html, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	html.Header.Set("Accept", "text/*, application/json;q=0")
+	doRequest(t, client, html)
+	resp, body := doRequest(t, client, html)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "1", body)
+
+	jsonReq, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	jsonReq.Header.Set("Accept", "application/json")
+	resp, body = doRequest(t, client, jsonReq)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	require.Equal(t, "2", body)
+
+	resp, body = doRequest(t, client, jsonReq)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "2", body)
+	require.Equal(t, 2, hits)
+}
@@ -0,0 +1,53 @@
+package httpcache
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type contextKey int
+
+const (
+	forceReloadContextKey contextKey = iota
+	ttlContextKey
+)
+
+// ForceReload will return a shallow copy of the request with browser-reload semantics.
+// The stored response (if any) will not be served, the request always goes to the origin,
+// and the fresh response will replace the stored one when it's cacheable.
+func ForceReload(req *http.Request) *http.Request {
+	return req.WithContext(WithNoCache(req.Context()))
+}
+
+// WithNoCache will return a copy of the context skipping the cache lookup of the requests using it, like ForceReload
+// but without copying the request. The fresh response is still stored when it's cacheable.
+func WithNoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceReloadContextKey, true)
+}
+
+func isForceReload(req *http.Request) bool {
+	forced, _ := req.Context().Value(forceReloadContextKey).(bool)
+	return forced
+}
+
+// WithTTL will return a copy of the context with the lifetime of the response stored for a request using it.
+// It overrides the freshness from the response headers and the BodyPolicyFunc, but is still capped by MaxTTL.
+func WithTTL(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, ttlContextKey, ttl)
+}
+
+// detachedContext keep the values of its parent, but is never canceled
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) { return }
+func (detachedContext) Done() <-chan struct{}                   { return nil }
+func (detachedContext) Err() error                              { return nil }
+func (c detachedContext) Value(key interface{}) interface{}     { return c.parent.Value(key) }
+
+func contextTTL(req *http.Request) time.Duration {
+	ttl, _ := req.Context().Value(ttlContextKey).(time.Duration)
+	return ttl
+}
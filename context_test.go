@@ -0,0 +1,107 @@
+package httpcache_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForceReload(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	client := &http.Client{
+		Transport: httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache()),
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	_, body := doRequest(t, client, req)
+	require.Equal(t, "1", body)
+
+	resp, body := doRequest(t, client, req)
+	require.Equal(t, "1", body)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+
+	// the reload must skip the stored entry and replace it
+	resp, body = doRequest(t, client, httpcache.ForceReload(req))
+	require.Equal(t, "2", body)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+
+	resp, body = doRequest(t, client, req)
+	require.Equal(t, "2", body)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.EqualValues(t, 2, *hits)
+}
+
+func TestWithNoCache(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	client := &http.Client{
+		Transport: httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache()),
+	}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, client, req)
+
+	// the valid entry is skipped, and replaced
+	resp, body := doRequest(t, client, req.WithContext(httpcache.WithNoCache(req.Context())))
+	require.Equal(t, "2", body)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+
+	resp, body = doRequest(t, client, req)
+	require.Equal(t, "2", body)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.EqualValues(t, 2, *hits)
+}
+
+func TestWithTTL(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	// the context TTL overrides the hour from the response header
+	doRequest(t, client, req.WithContext(httpcache.WithTTL(req.Context(), time.Millisecond*200)))
+	resp, body := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "1", body)
+
+	time.Sleep(time.Millisecond * 300)
+	resp, body = doRequest(t, client, req)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "2", body)
+
+	// and it's still capped by the MaxTTL
+	handler.MaxTTL = time.Millisecond * 200
+	doRequest(t, client, httpcache.ForceReload(req.WithContext(httpcache.WithTTL(req.Context(), time.Hour))))
+	_, body = doRequest(t, client, req)
+	require.Equal(t, "3", body)
+	time.Sleep(time.Millisecond * 300)
+	_, body = doRequest(t, client, req)
+	require.Equal(t, "4", body)
+	require.EqualValues(t, 4, *hits)
+}
+
+func TestMaxTTL(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.MaxTTL = time.Millisecond * 200
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	_, body := doRequest(t, client, req)
+	require.Equal(t, "1", body)
+	time.Sleep(time.Millisecond * 300)
+	_, body = doRequest(t, client, req)
+	require.Equal(t, "2", body)
+	require.EqualValues(t, 2, *hits)
+}
@@ -0,0 +1,118 @@
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/bxcodec/httpcache/cache"
+	cacheControl "github.com/bxcodec/httpcache/helper/cacheheader"
+)
+
+// DebugEntry represent a stored cache item listed by the DebugHandler
+type DebugEntry struct {
+	Key        string    `json:"key"`
+	Size       int       `json:"size"`       // The size of the stored dumped response in bytes, compressed or not
+	CachedTime time.Time `json:"cachedTime"` // The timestamp when this response is Cached
+	ExpiresAt  time.Time `json:"expiresAt"`  // Zero when the stored response carries no freshness information
+}
+
+// DebugHandler will return an http.Handler to inspect the cache contents for local debugging.
+//   - GET lists all the stored entries, it requires the storage to implement cache.IKeyLister
+//   - DELETE ?key=<key> deletes the given key from the storage
+//
+// The handler exposes every cached response, so only mount it on an admin mux behind authentication.
+func DebugHandler(r *CacheHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			r.listCacheEntries(w)
+		case http.MethodDelete:
+			key := req.URL.Query().Get("key")
+			if key == "" {
+				http.Error(w, "missing key parameter", http.StatusBadRequest)
+				return
+			}
+			if err := r.CacheInteractor.Delete(key); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (r *CacheHandler) listCacheEntries(w http.ResponseWriter) {
+	lister, ok := r.CacheInteractor.(cache.IKeyLister)
+	if !ok {
+		http.Error(w, "the cache storage can't list its keys", http.StatusNotImplemented)
+		return
+	}
+	keys, err := lister.Keys()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entries := []DebugEntry{}
+	for _, key := range keys {
+		item, err := r.CacheInteractor.Get(key)
+		if err != nil {
+			// the item might be expired or deleted after listing the keys
+			continue
+		}
+		entries = append(entries, DebugEntry{
+			Key:        key,
+			Size:       len(item.DumpedResponse),
+			CachedTime: item.CachedTime,
+			ExpiresAt:  r.storedExpiration(item),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+// storedExpiration will compute the expiration of the stored response relative to the time it was cached
+func (r *CacheHandler) storedExpiration(item cache.CachedResponse) (expiresAt time.Time) {
+	if !item.ExpiresAt.IsZero() {
+		return item.ExpiresAt
+	}
+	dumped, err := dumpedResponse(item)
+	if err != nil {
+		return
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(dumped)), nil)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	respDir, err := cacheControl.ParseResponseCacheControl(resp.Header.Get(HeaderCacheControl))
+	if err != nil {
+		return
+	}
+	// unparseable headers are treated as absent, this is only informative
+	dateHeader, _ := http.ParseTime(resp.Header.Get("Date"))
+	expiresHeader := parseExpires(resp.Header, dateHeader, item.CachedTime)
+	lastModifiedHeader, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	obj := cacheControl.Object{
+		RespDirectives:         respDir,
+		RespHeaders:            resp.Header,
+		RespStatusCode:         resp.StatusCode,
+		RespExpiresHeader:      expiresHeader,
+		RespDateHeader:         dateHeader,
+		RespLastModifiedHeader: lastModifiedHeader,
+		NowUTC:                 item.CachedTime.UTC(),
+		CacheIsPrivate:         !r.Shared,
+	}
+	validationResult := cacheControl.ObjectResults{}
+	cacheControl.ExpirationObject(&obj, &validationResult)
+	return validationResult.OutExpirationTime
+}
@@ -0,0 +1,48 @@
+package httpcache_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func listDebugEntries(t *testing.T, debugHandler http.Handler) (entries []httpcache.DebugEntry) {
+	rec := httptest.NewRecorder()
+	debugHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/cache", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&entries))
+	return
+}
+
+func TestDebugHandler(t *testing.T) {
+	server, _ := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	debugHandler := httpcache.DebugHandler(handler)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, client, req)
+
+	entries := listDebugEntries(t, debugHandler)
+	require.Len(t, entries, 1)
+	require.NotZero(t, entries[0].Size)
+	require.WithinDuration(t, time.Now(), entries[0].CachedTime, time.Second*5)
+	require.WithinDuration(t, entries[0].CachedTime.Add(time.Hour), entries[0].ExpiresAt, time.Second)
+
+	rec := httptest.NewRecorder()
+	debugHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/debug/cache?key="+url.QueryEscape(entries[0].Key), nil))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Empty(t, listDebugEntries(t, debugHandler))
+
+	rec = httptest.NewRecorder()
+	debugHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/debug/cache", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
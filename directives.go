@@ -0,0 +1,105 @@
+package httpcache
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	cacheControl "github.com/bxcodec/httpcache/helper/cacheheader"
+)
+
+// Directives represent the parsed Cache-Control header of a response.
+// The durations are nil when their directive is absent.
+type Directives struct {
+	MaxAge               *time.Duration
+	SMaxAge              *time.Duration
+	StaleIfError         *time.Duration
+	StaleWhileRevalidate *time.Duration
+	NoCache              bool
+	NoCacheFields        []string // The header names of a `no-cache="..."`, sorted
+	NoStore              bool
+	NoTransform          bool
+	Public               bool
+	Private              bool
+	PrivateFields        []string // The header names of a `private="..."`, sorted
+	MustRevalidate       bool
+	ProxyRevalidate      bool
+	Immutable            bool
+	Extensions           []string // The unknown directives, e.g. `community="UCI"`
+}
+
+// RequestDirectives represent the parsed Cache-Control header of a request.
+// The durations are nil when their directive is absent.
+type RequestDirectives struct {
+	MaxAge       *time.Duration
+	MaxStale     *time.Duration
+	MinFresh     *time.Duration
+	NoCache      bool
+	NoStore      bool
+	NoTransform  bool
+	OnlyIfCached bool
+	Extensions   []string // The unknown directives
+}
+
+// ParseResponseDirectives will parse the Cache-Control header of a response, the same way the cache does
+func ParseResponseDirectives(resp *http.Response) (Directives, error) {
+	dir, err := cacheControl.ParseResponseCacheControl(resp.Header.Get(HeaderCacheControl))
+	if err != nil {
+		return Directives{}, err
+	}
+	return Directives{
+		MaxAge:               deltaSeconds(dir.MaxAge),
+		SMaxAge:              deltaSeconds(dir.SMaxAge),
+		StaleIfError:         deltaSeconds(dir.StaleIfError),
+		StaleWhileRevalidate: deltaSeconds(dir.StaleWhileRevalidate),
+		NoCache:              dir.NoCachePresent,
+		NoCacheFields:        fieldNames(dir.NoCache),
+		NoStore:              dir.NoStore,
+		NoTransform:          dir.NoTransform,
+		Public:               dir.Public,
+		Private:              dir.PrivatePresent,
+		PrivateFields:        fieldNames(dir.Private),
+		MustRevalidate:       dir.MustRevalidate,
+		ProxyRevalidate:      dir.ProxyRevalidate,
+		Immutable:            dir.Immutable,
+		Extensions:           dir.Extensions,
+	}, nil
+}
+
+// ParseRequestDirectives will parse the Cache-Control header of a request, the same way the cache does
+func ParseRequestDirectives(req *http.Request) (RequestDirectives, error) {
+	dir, err := cacheControl.ParseRequestCacheControl(req.Header.Get(HeaderCacheControl))
+	if err != nil {
+		return RequestDirectives{}, err
+	}
+	return RequestDirectives{
+		MaxAge:       deltaSeconds(dir.MaxAge),
+		MaxStale:     deltaSeconds(dir.MaxStale),
+		MinFresh:     deltaSeconds(dir.MinFresh),
+		NoCache:      dir.NoCache,
+		NoStore:      dir.NoStore,
+		NoTransform:  dir.NoTransform,
+		OnlyIfCached: dir.OnlyIfCached,
+		Extensions:   dir.Extensions,
+	}, nil
+}
+
+func deltaSeconds(v cacheControl.DeltaSeconds) *time.Duration {
+	if v < 0 {
+		return nil
+	}
+	d := time.Duration(v) * time.Second
+	return &d
+}
+
+func fieldNames(names cacheControl.FieldNames) []string {
+	if len(names) == 0 {
+		return nil
+	}
+	res := make([]string, 0, len(names))
+	for name := range names {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,74 @@
+package httpcache_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func seconds(n int) *time.Duration {
+	d := time.Duration(n) * time.Second
+	return &d
+}
+
+func TestParseResponseDirectives(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		expected     httpcache.Directives
+	}{
+		{cacheControl: "", expected: httpcache.Directives{}},
+		{
+			cacheControl: "public, max-age=60, s-maxage=120",
+			expected:     httpcache.Directives{Public: true, MaxAge: seconds(60), SMaxAge: seconds(120)},
+		},
+		{
+			cacheControl: `private="set-cookie, x-user", no-cache, must-revalidate`,
+			expected: httpcache.Directives{
+				Private:        true,
+				PrivateFields:  []string{"Set-Cookie", "X-User"},
+				NoCache:        true,
+				MustRevalidate: true,
+			},
+		},
+		{
+			cacheControl: `max-age=0, stale-while-revalidate=30, stale-if-error=300, immutable, community="UCI"`,
+			expected: httpcache.Directives{
+				MaxAge:               seconds(0),
+				StaleWhileRevalidate: seconds(30),
+				StaleIfError:         seconds(300),
+				Immutable:            true,
+				Extensions:           []string{"community=UCI"},
+			},
+		},
+	}
+	for _, test := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Set("Cache-Control", test.cacheControl)
+		directives, err := httpcache.ParseResponseDirectives(resp)
+		require.NoError(t, err, test.cacheControl)
+		require.Equal(t, test.expected, directives, test.cacheControl)
+	}
+
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("Cache-Control", "max-age=abc")
+	_, err := httpcache.ParseResponseDirectives(resp)
+	require.Error(t, err)
+}
+
+func TestParseRequestDirectives(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	require.NoError(t, err)
+	req.Header.Set("Cache-Control", "max-age=10, min-fresh=5, no-transform, only-if-cached")
+
+	directives, err := httpcache.ParseRequestDirectives(req)
+	require.NoError(t, err)
+	require.Equal(t, httpcache.RequestDirectives{
+		MaxAge:       seconds(10),
+		MinFresh:     seconds(5),
+		NoTransform:  true,
+		OnlyIfCached: true,
+	}, directives)
+}
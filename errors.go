@@ -0,0 +1,32 @@
+package httpcache
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bxcodec/httpcache/cache"
+)
+
+// Errors of the cache handler, the internal errors wrap them so they can be matched with errors.Is
+var (
+	// ErrCacheMiss will throw when there is no stored response for the request, it's the same as cache.ErrCacheMissed
+	ErrCacheMiss = cache.ErrCacheMissed
+	// ErrExpired will throw when the stored response is not fresh enough to be served
+	ErrExpired = errors.New("cached-item already expired")
+	// ErrNotCacheable will throw when the response can't be stored
+	ErrNotCacheable = errors.New("response is not cacheable")
+	// ErrBackend will throw when the cache storage failed
+	ErrBackend = errors.New("cache storage failed")
+	// ErrKeysNotListable will throw when the cache storage doesn't implement cache.IKeyLister
+	ErrKeysNotListable = errors.New("the cache storage can't list its keys")
+	// ErrNotPurgeable will throw when the request is never cached, e.g. without an absolute URL or a tenant
+	ErrNotPurgeable = errors.New("the request has no cache entry to purge")
+)
+
+// storageError will classify an error returned by the cache storage
+func storageError(err error) error {
+	if err == nil || errors.Is(err, ErrCacheMiss) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrBackend, err)
+}
@@ -0,0 +1,104 @@
+package httpcache
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache/cache"
+	"github.com/bxcodec/httpcache/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newErrorTestResponse(req *http.Request, cacheControl string) *http.Response {
+	resp := &http.Response{
+		StatusCode:    http.StatusOK,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          http.NoBody,
+		Request:       req,
+		ContentLength: 0,
+	}
+	resp.Header.Set("Cache-Control", cacheControl)
+	return resp
+}
+
+func TestErrorHierarchy(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/hello", nil)
+	require.NoError(t, err)
+
+	t.Run("cache-miss", func(t *testing.T) {
+		mockCacheInteractor := new(mocks.ICacheInteractor)
+		mockCacheInteractor.On("Get", mock.AnythingOfType("string")).Return(cache.CachedResponse{}, cache.ErrCacheMissed)
+		handler := NewCacheHandlerRoundtrip(http.DefaultTransport, true, mockCacheInteractor)
+
+		_, _, err := handler.getCachedResponse("key", req)
+		require.True(t, errors.Is(err, ErrCacheMiss))
+		require.False(t, errors.Is(err, ErrBackend))
+	})
+
+	t.Run("backend", func(t *testing.T) {
+		mockCacheInteractor := new(mocks.ICacheInteractor)
+		mockCacheInteractor.On("Get", mock.AnythingOfType("string")).Return(cache.CachedResponse{}, errors.New("connection refused"))
+		mockCacheInteractor.On("Set", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(errors.New("connection refused"))
+		handler := NewCacheHandlerRoundtrip(http.DefaultTransport, true, mockCacheInteractor)
+
+		_, _, err := handler.getCachedResponse("key", req)
+		require.True(t, errors.Is(err, ErrBackend))
+		require.False(t, errors.Is(err, ErrCacheMiss))
+
+		err = handler.storeRespToCache("key", req, newErrorTestResponse(req, "max-age=60"), 0)
+		require.True(t, errors.Is(err, ErrBackend))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		dumped, err := httputil.DumpResponse(newErrorTestResponse(req, "max-age=60"), true)
+		require.NoError(t, err)
+		cachedResp := cache.CachedResponse{
+			DumpedResponse: dumped,
+			RequestURI:     req.URL.String(),
+			CachedTime:     time.Now().Add(-time.Hour),
+			ExpiresAt:      time.Now().Add(-time.Minute),
+		}
+		mockCacheInteractor := new(mocks.ICacheInteractor)
+		mockCacheInteractor.On("Get", mock.AnythingOfType("string")).Return(cachedResp, nil)
+		handler := NewCacheHandlerRoundtrip(http.DefaultTransport, true, mockCacheInteractor)
+
+		_, _, err = handler.getCachedResponse("key", req)
+		require.True(t, errors.Is(err, ErrExpired))
+
+		cachedResp.ExpiresAt = time.Now().Add(time.Second)
+		mockCacheInteractor = new(mocks.ICacheInteractor)
+		mockCacheInteractor.On("Get", mock.AnythingOfType("string")).Return(cachedResp, nil)
+		handler = NewCacheHandlerRoundtrip(http.DefaultTransport, true, mockCacheInteractor)
+		handler.ServeFreshnessFloor = time.Minute
+
+		_, _, err = handler.getCachedResponse("key", req)
+		require.True(t, errors.Is(err, ErrExpired))
+	})
+
+	t.Run("corrupted", func(t *testing.T) {
+		mockCacheInteractor := new(mocks.ICacheInteractor)
+		mockCacheInteractor.On("Get", "key").Return(cache.CachedResponse{DumpedResponse: []byte("HTTP/1.1 2")}, nil)
+		mockCacheInteractor.On("Delete", "key").Return(nil)
+		handler := NewCacheHandlerRoundtrip(http.DefaultTransport, true, mockCacheInteractor)
+
+		// dropped, so it's not read again even if the live version isn't stored
+		_, _, err := handler.getCachedResponse("key", req)
+		require.True(t, errors.Is(err, ErrCacheMiss))
+		mockCacheInteractor.AssertCalled(t, "Delete", "key")
+	})
+
+	t.Run("not-cacheable", func(t *testing.T) {
+		err := (&CacheHandler{}).validateStorable(req, newErrorTestResponse(req, "no-store"))
+		require.True(t, errors.Is(err, ErrNotCacheable))
+		require.True(t, strings.HasPrefix(err.Error(), ErrNotCacheable.Error()))
+
+		require.NoError(t, (&CacheHandler{}).validateStorable(req, newErrorTestResponse(req, "max-age=60")))
+	})
+}
@@ -22,8 +22,11 @@ func NewCustomInMemStorage() cache.ICacheInteractor {
 	}
 }
 
-func (c customInMemStorage) Set(key string, value cache.CachedResponse) error {
-	c.cacheHandler.Set(key, value, patrickCache.DefaultExpiration)
+func (c customInMemStorage) Set(key string, value cache.CachedResponse, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = patrickCache.DefaultExpiration
+	}
+	c.cacheHandler.Set(key, value, ttl)
 	return nil
 }
 
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/bxcodec/httpcache"
@@ -43,6 +45,16 @@ func Example_inMemoryStorageDefault() {
 	*/
 }
 
+func Example_diskStorage() {
+	client := &http.Client{}
+	handler, err := httpcache.NewWithDiskCache(client, true, filepath.Join(os.TempDir(), "httpcache"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	processCachedRequest(client, handler)
+}
+
 func Example_redisStorage() {
 	client := &http.Client{}
 	handler, err := httpcache.NewWithRedisCache(client, true, &redis.CacheOptions{
@@ -0,0 +1,53 @@
+package httpcache
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bxcodec/httpcache/cache"
+	cacheControl "github.com/bxcodec/httpcache/helper/cacheheader"
+)
+
+// checkFreshness will return ErrExpired when the stored response can't be served to the request at now, from
+// its expiration and the request max-age, min-fresh and max-stale directives, https://tools.ietf.org/html/rfc7234#section-5.2.1
+// A fresh immutable response is served whatever the request directives, https://tools.ietf.org/html/rfc8246
+func checkFreshness(req *http.Request, resp *http.Response, item cache.CachedResponse, expiresAt, now time.Time) error {
+	if !now.After(expiresAt) && isImmutable(resp.Header) {
+		return nil
+	}
+	reqDir, err := cacheControl.ParseRequestCacheControl(req.Header.Get(HeaderCacheControl))
+	if err != nil {
+		reqDir = &cacheControl.RequestCacheDirectives{MaxAge: -1, MaxStale: -1, MinFresh: -1}
+	}
+	if reqDir.MaxAge != -1 && currentAge(resp.Header, item, now) > seconds(reqDir.MaxAge) {
+		return fmt.Errorf("%w: it's older than the max-age of the request", ErrExpired)
+	}
+	if reqDir.MinFresh != -1 && now.Add(seconds(reqDir.MinFresh)).After(expiresAt) {
+		return fmt.Errorf("%w: it expires within the min-fresh of the request", ErrExpired)
+	}
+	if !now.After(expiresAt) {
+		return nil
+	}
+	if reqDir.MaxStale != -1 && !now.After(expiresAt.Add(seconds(reqDir.MaxStale))) && !mustRevalidate(resp.Header) {
+		return nil // the client accepts it stale
+	}
+	return ErrExpired
+}
+
+// mustRevalidate will check if the response forbids to be served stale, with must-revalidate or proxy-revalidate
+// (also honored by a private cache, it's never wrong to revalidate), https://tools.ietf.org/html/rfc7234#section-5.2.2.1
+func mustRevalidate(header http.Header) bool {
+	dir, err := cacheControl.ParseResponseCacheControl(header.Get(HeaderCacheControl))
+	return err == nil && (dir.MustRevalidate || dir.ProxyRevalidate)
+}
+
+// isImmutable will check if the response never changes while it's fresh, so it's never revalidated before expiring
+func isImmutable(header http.Header) bool {
+	dir, err := cacheControl.ParseResponseCacheControl(header.Get(HeaderCacheControl))
+	return err == nil && dir.Immutable
+}
+
+func seconds(delta cacheControl.DeltaSeconds) time.Duration {
+	return time.Duration(delta) * time.Second
+}
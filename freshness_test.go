@@ -0,0 +1,59 @@
+package httpcache
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache/cache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckFreshness(t *testing.T) {
+	// stored 10s ago, expiring in 20s or expired 20s ago
+	now := time.Date(2020, 6, 21, 13, 14, 51, 0, time.UTC)
+	item := cache.CachedResponse{CachedTime: now.Add(-10 * time.Second)}
+	fresh, stale := now.Add(20*time.Second), now.Add(-20*time.Second)
+
+	tests := []struct {
+		name         string
+		cacheControl string
+		respControl  string
+		expiresAt    time.Time
+		expired      bool
+	}{
+		{name: "fresh", expiresAt: fresh},
+		{name: "stale", expiresAt: stale, expired: true},
+		{name: "max-age=0", cacheControl: "max-age=0", expiresAt: fresh, expired: true},
+		{name: "older than max-age", cacheControl: "max-age=5", expiresAt: fresh, expired: true},
+		{name: "younger than max-age", cacheControl: "max-age=10", expiresAt: fresh},
+		{name: "min-fresh satisfied", cacheControl: "min-fresh=20", expiresAt: fresh},
+		{name: "min-fresh rejected", cacheControl: "min-fresh=21", expiresAt: fresh, expired: true},
+		{name: "within max-stale", cacheControl: "max-stale=20", expiresAt: stale},
+		{name: "beyond max-stale", cacheControl: "max-stale=19", expiresAt: stale, expired: true},
+		{name: "max-stale without value", cacheControl: "max-stale", expiresAt: now.Add(-24 * 365 * time.Hour)},
+		{name: "max-stale without value with must-revalidate", cacheControl: "max-stale", respControl: "must-revalidate",
+			expiresAt: stale, expired: true},
+		{name: "max-stale with must-revalidate", cacheControl: "max-stale=60", respControl: "must-revalidate",
+			expiresAt: stale, expired: true},
+		{name: "max-stale with proxy-revalidate", cacheControl: "max-stale=60", respControl: "proxy-revalidate",
+			expiresAt: stale, expired: true},
+		{name: "max-age=0 with immutable", cacheControl: "max-age=0", respControl: "immutable", expiresAt: fresh},
+		{name: "min-fresh with immutable", cacheControl: "min-fresh=60", respControl: "immutable", expiresAt: fresh},
+		{name: "stale with immutable", respControl: "immutable", expiresAt: stale, expired: true},
+		{name: "max-age within max-stale", cacheControl: "max-age=5, max-stale=60", expiresAt: stale, expired: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			require.NoError(t, err)
+			req.Header.Set(HeaderCacheControl, test.cacheControl)
+			resp := &http.Response{Header: http.Header{}}
+			resp.Header.Set(HeaderCacheControl, test.respControl)
+
+			err = checkFreshness(req, resp, item, test.expiresAt, now)
+			require.Equal(t, test.expired, errors.Is(err, ErrExpired), err)
+		})
+	}
+}
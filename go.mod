@@ -5,9 +5,11 @@ go 1.13
 require (
 	github.com/alicebob/miniredis v2.5.0+incompatible
 	github.com/alicebob/miniredis/v2 v2.13.0
+	github.com/andybalholm/brotli v1.0.0
 	github.com/bxcodec/gotcha v1.0.0-beta.2
 	github.com/go-redis/redis/v8 v8.0.0-beta.5
 	github.com/patrickmn/go-cache v2.1.0+incompatible
 	github.com/stretchr/testify v1.5.1
 	golang.org/x/net v0.0.0-20190923162816-aa69164e4478
+	golang.org/x/sync v0.1.0
 )
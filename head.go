@@ -0,0 +1,26 @@
+package httpcache
+
+import (
+	"net/http"
+
+	"github.com/bxcodec/httpcache/cache"
+)
+
+// headFromGet will return the fresh GET entry of the URL for a HEAD request without its own entry,
+// read without its body like the origin would reply to the HEAD request.
+func (r *CacheHandler) headFromGet(req *http.Request) (resp *http.Response, item cache.CachedResponse, ok bool) {
+	if req.Method != http.MethodHead {
+		return nil, item, false
+	}
+	getReq := req.Clone(req.Context())
+	getReq.Method = http.MethodGet
+	// read for the HEAD request, so its body is discarded
+	resp, item, err := r.getCachedResponse(r.cacheKey(getReq), req)
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, item, false
+	}
+	return resp, item, true
+}
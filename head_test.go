@@ -0,0 +1,56 @@
+package httpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeadFromCachedGet(t *testing.T) {
+	hits := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.Method]++
+		w.Header().Set("Cache-Control", "max-age=1")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Vary", "Accept-Language")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte("hello " + r.Header.Get("Accept-Language")))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	get, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	get.Header.Set("Accept-Language", "en")
+	head, err := http.NewRequest(http.MethodHead, server.URL, nil)
+	require.NoError(t, err)
+	head.Header.Set("Accept-Language", "en")
+
+	stored, _ := doRequest(t, client, get)
+	resp, body := doRequest(t, client, head)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, stored.Header.Get("Content-Type"), resp.Header.Get("Content-Type"))
+	require.Equal(t, stored.Header.Get("Content-Length"), resp.Header.Get("Content-Length"))
+	require.Empty(t, body)
+	require.Equal(t, 0, hits[http.MethodHead])
+
+	// another variant
+	head.Header.Set("Accept-Language", "fr")
+	resp, _ = doRequest(t, client, head)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, 1, hits[http.MethodHead])
+
+	// not fresh anymore
+	head.Header.Set("Accept-Language", "en")
+	time.Sleep(time.Millisecond * 1100)
+	resp, _ = doRequest(t, client, head)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, 2, hits[http.MethodHead])
+	require.Equal(t, 1, hits[http.MethodGet])
+}
@@ -0,0 +1,21 @@
+package httpcache
+
+// HeaderNames are the names of the headers added to the cached responses, e.g. the branded names of a team,
+// or the names a proxy doesn't strip. An empty name is the default one.
+type HeaderNames struct {
+	FromCache string // XFromHache by default
+	Origin    string // XHacheOrigin by default
+	Name      string // XHacheName by default
+}
+
+// orDefault will return the name, or the default one when it's empty
+func orDefault(name, defaultName string) string {
+	if name == "" {
+		return defaultName
+	}
+	return name
+}
+
+func (n HeaderNames) fromCache() string { return orDefault(n.FromCache, XFromHache) }
+func (n HeaderNames) origin() string    { return orDefault(n.Origin, XHacheOrigin) }
+func (n HeaderNames) name() string      { return orDefault(n.Name, XHacheName) }
@@ -0,0 +1,70 @@
+package httpcache
+
+import (
+	"net/http"
+
+	"github.com/bxcodec/httpcache/cache"
+)
+
+// probedHeaders are compared between a HEAD probe and the stored response, they must all be equal
+var probedHeaders = []string{"Content-Length", "ETag", "Last-Modified"}
+
+// hasValidator will check if the response can be revalidated with a conditional request
+func hasValidator(header http.Header) bool {
+	return header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+}
+
+// revalidationRoundTripper will return the transport of the revalidation requests
+func (r *CacheHandler) revalidationRoundTripper() http.RoundTripper {
+	if r.RevalidationRoundTripper != nil {
+		return r.RevalidationRoundTripper
+	}
+	return r.DefaultRoundTripper
+}
+
+// revalidateWithHead will probe the origin with a HEAD request to check if the expired stored response,
+// without any validator, is still the current one. When it is, the stored entry is renewed with the
+// freshness of the probe and returned.
+func (r *CacheHandler) revalidateWithHead(key string, req *http.Request, stored *http.Response,
+	item cache.CachedResponse) (renewed cache.CachedResponse, ok bool) {
+	if hasValidator(stored.Header) || stored.Header.Get("Content-Length") == "" {
+		return
+	}
+	probeReq, err := http.NewRequestWithContext(req.Context(), http.MethodHead, req.URL.String(), nil)
+	if err != nil {
+		return
+	}
+	probeReq.Header = req.Header.Clone()
+	probe, err := r.revalidationRoundTripper().RoundTrip(probeReq)
+	if err != nil {
+		r.logger().Printf("Can't probe the origin with a HEAD request, plase check. Err: %v\n", err)
+		return
+	}
+	probe.Body.Close()
+	if probe.StatusCode != http.StatusOK {
+		return
+	}
+	for _, name := range probedHeaders {
+		if probe.Header.Get(name) != stored.Header.Get(name) {
+			return
+		}
+	}
+
+	ttl := r.headerFreshness(probeReq, probe)
+	if ttl <= 0 {
+		ttl = r.DefaultTTL
+	}
+	ttl = r.clampTTL(probeReq, probe, ttl)
+	renewed = item
+	if ttl > 0 {
+		renewed.CachedTime = r.now()
+		renewed.ExpiresAt = renewed.CachedTime.Add(ttl)
+		if err := r.setEntry(key, req, renewed); err != nil {
+			r.observer().OnError(key, err)
+			r.logger().Printf("Can't renew the probed response in the database, plase check. Err: %v\n", err)
+		} else {
+			r.observer().OnStore(key)
+		}
+	}
+	return renewed, true
+}
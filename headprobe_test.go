@@ -0,0 +1,88 @@
+package httpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeadRevalidation(t *testing.T) {
+	body := "hello"
+	gets, heads := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads++
+		} else {
+			gets++
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(body))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.DefaultTTL = time.Millisecond * 100
+	handler.HeadRevalidation = true
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	time.Sleep(time.Millisecond * 150)
+
+	// same Content-Length, the stored body is still valid
+	resp, got := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "hello", got)
+	require.Equal(t, 1, gets)
+	require.Equal(t, 1, heads)
+
+	// and it's renewed for the DefaultTTL
+	resp, _ = doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, 1, heads)
+
+	body = "hello world"
+	time.Sleep(time.Millisecond * 150)
+	resp, got = doRequest(t, client, req)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "hello world", got)
+	require.Equal(t, 2, gets)
+	require.Equal(t, 2, heads)
+}
+
+func TestRevalidationRoundTripper(t *testing.T) {
+	server, hits := newCountingServer(t, "")
+	defer server.Close()
+	revalidations := 0
+	validator := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		revalidations++
+		require.Equal(t, http.MethodHead, req.Method)
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.RevalidationRoundTripper = validator
+	handler.DefaultTTL = time.Millisecond * 100
+	handler.HeadRevalidation = true
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	require.Equal(t, 0, revalidations)
+	time.Sleep(time.Millisecond * 150)
+
+	// the probe goes to the revalidation transport, and matches the stored Content-Length
+	resp, body := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "1", body)
+	require.Equal(t, 1, revalidations)
+	// the counting server also counts the probe
+	require.EqualValues(t, 2, *hits)
+}
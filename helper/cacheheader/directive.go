@@ -33,7 +33,7 @@ var (
 	ErrQuoteMismatch         = errors.New("missing closing quote")
 	ErrMaxAgeDeltaSeconds    = errors.New("failed to parse delta-seconds in `max-age`")
 	ErrSMaxAgeDeltaSeconds   = errors.New("failed to parse delta-seconds in `s-maxage`")
-	ErrMaxStaleDeltaSeconds  = errors.New("failed to parse delta-seconds in `min-fresh`")
+	ErrMaxStaleDeltaSeconds  = errors.New("failed to parse delta-seconds in `max-stale`")
 	ErrMinFreshDeltaSeconds  = errors.New("failed to parse delta-seconds in `min-fresh`")
 	ErrNoCacheNoArgs         = errors.New("unexpected argument to `no-cache`")
 	ErrNoStoreNoArgs         = errors.New("unexpected argument to `no-store`")
@@ -252,7 +252,8 @@ func (cd *RequestCacheDirectives) addToken(token string) error {
 	case HeaderMaxAge:
 		err = ErrMaxAgeDeltaSeconds
 	case HeaderMaxStale:
-		err = ErrMaxStaleDeltaSeconds
+		// without a value, a stale response of any age is accepted
+		cd.MaxStale = DeltaSeconds(math.MaxInt32)
 	case HeaderMinFresh:
 		err = ErrMinFreshDeltaSeconds
 	case HeaderNoCache:
@@ -347,8 +347,15 @@ func TestReqMaxAgeBroken(t *testing.T) {
 	require.Nil(t, cd)
 }
 
-func TestReqMaxStaleBroken(t *testing.T) {
+func TestReqMaxStaleNoValue(t *testing.T) {
 	cd, err := cacheControl.ParseRequestCacheControl(`max-stale`)
+	require.NoError(t, err)
+	require.NotNil(t, cd)
+	require.Equal(t, cd.MaxStale, cacheControl.DeltaSeconds(math.MaxInt32))
+}
+
+func TestReqMaxStaleBroken(t *testing.T) {
+	cd, err := cacheControl.ParseRequestCacheControl(`max-stale=a`)
 	require.Error(t, err)
 	require.Equal(t, cacheControl.ErrMaxStaleDeltaSeconds, err)
 	require.Nil(t, cd)
@@ -204,8 +204,18 @@ func ExpirationObject(obj *Object, rv *ObjectResults) {
 		//
 		// obj.NowUTC
 
-		since := obj.RespLastModifiedHeader.Sub(obj.NowUTC)
-		since = time.Duration(float64(since) * -0.1)
+		// the age of the content when it was sent, so a cached object doesn't get fresher while stored.
+		// Without a Date header, the time it's received is the best estimate.
+		serverDate := obj.RespDateHeader
+		if serverDate.IsZero() {
+			serverDate = obj.NowUTC
+		}
+		since := serverDate.Sub(obj.RespLastModifiedHeader)
+		if since < 0 {
+			// a Last-Modified in the future (e.g. a clock skew) gives no freshness
+			since = 0
+		}
+		since = time.Duration(float64(since) * 0.1)
 
 		if since > twentyFourHours {
 			expiresTime = obj.NowUTC.Add(twentyFourHours)
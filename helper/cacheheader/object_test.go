@@ -395,3 +395,56 @@ func TestExpirationExpiresNoServerDate(t *testing.T) {
 	require.Len(t, rv.OutWarnings, 0)
 	require.WithinDuration(t, now.Add(time.Second*1500), rv.OutExpirationTime, time.Second*1)
 }
+
+func TestExpirationMaxAgeOverridesExpires(t *testing.T) {
+	now := time.Now().UTC()
+
+	obj := fill(t, now)
+	// max-age must win over an Expires already in the past: https://tools.ietf.org/html/rfc7234#section-5.3
+	obj.RespDirectives.MaxAge = cacheControl.DeltaSeconds(60)
+	obj.RespExpiresHeader = now.Add(time.Hour * -1)
+
+	rv := cacheControl.ObjectResults{}
+	cacheControl.ExpirationObject(&obj, &rv)
+	require.Len(t, rv.OutWarnings, 0)
+	require.WithinDuration(t, now.Add(time.Second*60), rv.OutExpirationTime, time.Second*1)
+}
+
+func TestExpirationHeuristicNoServerDate(t *testing.T) {
+	now := time.Now().UTC()
+
+	obj := fill(t, now)
+	obj.RespDateHeader = time.Time{}
+	obj.RespLastModifiedHeader = now.Add(time.Hour * -70000)
+
+	rv := cacheControl.ObjectResults{}
+	cacheControl.ExpirationObject(&obj, &rv)
+	require.Equal(t, []cacheControl.Warning{cacheControl.WarningHeuristicExpiration}, rv.OutWarnings)
+	require.WithinDuration(t, now.Add(twentyFourHours), rv.OutExpirationTime, time.Second*1)
+}
+
+func TestExpirationHeuristicServerDate(t *testing.T) {
+	now := time.Now().UTC()
+
+	obj := fill(t, now)
+	// the age is taken from the Date header, not from the time it's evaluated
+	obj.RespDateHeader = now.Add(time.Hour * -1)
+	obj.RespLastModifiedHeader = now.Add(time.Hour * -11)
+
+	rv := cacheControl.ObjectResults{}
+	cacheControl.ExpirationObject(&obj, &rv)
+	require.WithinDuration(t, now.Add(time.Hour), rv.OutExpirationTime, time.Second*1)
+}
+
+func TestExpirationHeuristicFutureLastModified(t *testing.T) {
+	now := time.Now().UTC()
+
+	obj := fill(t, now)
+	obj.RespDateHeader = time.Time{}
+	obj.RespLastModifiedHeader = now.Add(time.Hour)
+
+	rv := cacheControl.ObjectResults{}
+	cacheControl.ExpirationObject(&obj, &rv)
+	require.WithinDuration(t, now, rv.OutExpirationTime, time.Second*1)
+	require.False(t, rv.OutExpirationTime.Before(now))
+}
@@ -0,0 +1,49 @@
+package httpcache
+
+import (
+	"net/http"
+	"strings"
+)
+
+// hopByHopHeaders are only meaningful for a single connection, https://tools.ietf.org/html/rfc7230#section-6.1
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// isHopByHop will check if the header only applies to the connection of the response header,
+// i.e. a hop-by-hop header or a header listed by its Connection header
+func isHopByHop(name string, header http.Header) bool {
+	name = http.CanonicalHeaderKey(name)
+	for _, hop := range hopByHopHeaders {
+		if name == http.CanonicalHeaderKey(hop) {
+			return true
+		}
+	}
+	for _, value := range header["Connection"] {
+		for _, listed := range strings.Split(value, ",") {
+			if http.CanonicalHeaderKey(strings.TrimSpace(listed)) == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withoutHopByHop will return a copy of the header without its hop-by-hop headers
+func withoutHopByHop(header http.Header) http.Header {
+	stored := make(http.Header, len(header))
+	for name, values := range header {
+		if !isHopByHop(name, header) {
+			stored[name] = append([]string(nil), values...)
+		}
+	}
+	return stored
+}
@@ -0,0 +1,81 @@
+package httpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHopByHopHeadersNotStored(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Connection", r.URL.Query().Get("connection"))
+		w.Header().Set("X-Connection-Token", "abc")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("X-Product", "123")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte("hello"))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+
+	for _, connection := range []string{"close", "X-Connection-Token"} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"?connection="+connection, nil)
+		require.NoError(t, err)
+		resp, _ := doRequest(t, client, req)
+		require.Equal(t, connection == "close", resp.Close)
+
+		resp, body := doRequest(t, client, req)
+		require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+		require.Equal(t, "hello", body)
+		require.Equal(t, "123", resp.Header.Get("X-Product"))
+		// the replayed response doesn't close the client connection
+		require.False(t, resp.Close)
+		require.Empty(t, resp.Header.Get("Connection"))
+		require.Empty(t, resp.Header.Get("Keep-Alive"))
+		if connection != "close" {
+			require.Empty(t, resp.Header.Get("X-Connection-Token"))
+		}
+	}
+}
+
+func TestHopByHopHeadersNotServed(t *testing.T) {
+	for _, connection := range []string{"close", "X-Connection-Token"} {
+		server, _ := newCountingServer(t, "max-age=3600")
+		handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+		client := &http.Client{Transport: handler}
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		doRequest(t, client, req)
+
+		// an entry stored with its hop-by-hop headers, e.g. by another writer of the storage
+		entries := listDebugEntries(t, httpcache.DebugHandler(handler))
+		require.Len(t, entries, 1)
+		item, err := handler.CacheInteractor.Get(entries[0].Key)
+		require.NoError(t, err)
+		hops := "Connection: " + connection + "\r\nKeep-Alive: timeout=5\r\nProxy-Authenticate: Basic\r\n" +
+			"Upgrade: websocket\r\nX-Connection-Token: abc\r\nX-Product: 123\r\n"
+		item.DumpedResponse = []byte(strings.Replace(string(item.DumpedResponse), "\r\n", "\r\n"+hops, 1))
+		require.NoError(t, handler.CacheInteractor.Set(entries[0].Key, item, time.Hour))
+
+		resp, body := doRequest(t, client, req)
+		require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+		require.Equal(t, "1", body)
+		require.Equal(t, "123", resp.Header.Get("X-Product"))
+		require.False(t, resp.Close)
+		for _, name := range []string{"Connection", "Keep-Alive", "Proxy-Authenticate", "Upgrade"} {
+			require.Empty(t, resp.Header.Get(name), name)
+		}
+		if connection != "close" {
+			require.Empty(t, resp.Header.Get("X-Connection-Token"))
+		}
+		server.Close()
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/bxcodec/gotcha"
 	inmemcache "github.com/bxcodec/gotcha/cache"
 	"github.com/bxcodec/httpcache/cache"
+	"github.com/bxcodec/httpcache/cache/disk"
 	"github.com/bxcodec/httpcache/cache/inmem"
 	rediscache "github.com/bxcodec/httpcache/cache/redis"
 	"github.com/go-redis/redis/v8"
@@ -59,5 +60,12 @@ func NewWithRedisCache(client *http.Client, rfcCompliance bool, options *redisca
 		DB:       options.DB,
 	})
 
-	return newClient(client, rfcCompliance, rediscache.NewCache(ctx, c, expiryTime))
+	return newClient(client, rfcCompliance, rediscache.NewNamespacedCache(ctx, c, options.Namespace, expiryTime,
+		rediscache.WithLogger(options.Logger)))
+}
+
+// NewWithDiskCache will create a complete cache-support of HTTP client with using a directory as the cache,
+// the cached responses are kept across the restarts of the process.
+func NewWithDiskCache(client *http.Client, rfcCompliance bool, dir string) (cachedHandler *CacheHandler, err error) {
+	return newClient(client, rfcCompliance, disk.NewCache(dir))
 }
@@ -0,0 +1,33 @@
+package httpcache
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// random will return a random number in [0, 1) from Rand
+func (r *CacheHandler) random() float64 {
+	if r.Rand != nil {
+		return r.Rand()
+	}
+	return rand.Float64()
+}
+
+// jitteredTTL will reduce the lifetime of the response by a random fraction of up to TTLJitter, a zero ttl is
+// the freshness from the response headers. It's the ttl as it is without jitter.
+func (r *CacheHandler) jitteredTTL(req *http.Request, resp *http.Response, ttl time.Duration) time.Duration {
+	if r.TTLJitter <= 0 {
+		return ttl
+	}
+	if ttl <= 0 {
+		if ttl = r.headerFreshness(req, resp); ttl <= 0 {
+			return 0
+		}
+	}
+	jitter := r.TTLJitter
+	if jitter > 1 {
+		jitter = 1
+	}
+	return ttl - time.Duration(float64(ttl)*jitter*r.random())
+}
@@ -0,0 +1,59 @@
+package httpcache_test
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+// storedTTLs will store the responses of n URLs, and return their lifetimes
+func storedTTLs(t *testing.T, n int, configure func(*httpcache.CacheHandler)) []time.Duration {
+	server, _ := newCountingServer(t, "")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.DefaultTTL = 100 * time.Second
+	configure(handler)
+	client := &http.Client{Transport: handler}
+	for i := 0; i < n; i++ {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/%d", server.URL, i), nil)
+		require.NoError(t, err)
+		doRequest(t, client, req)
+	}
+
+	entries := listDebugEntries(t, httpcache.DebugHandler(handler))
+	require.Len(t, entries, n)
+	ttls := make([]time.Duration, 0, n)
+	for _, entry := range entries {
+		ttls = append(ttls, entry.ExpiresAt.Sub(entry.CachedTime))
+	}
+	return ttls
+}
+
+func TestTTLJitter(t *testing.T) {
+	ttls := storedTTLs(t, 20, func(handler *httpcache.CacheHandler) {
+		handler.TTLJitter = 0.1
+		handler.Rand = rand.New(rand.NewSource(1)).Float64
+	})
+	distinct := map[time.Duration]bool{}
+	for _, ttl := range ttls {
+		require.True(t, ttl > 90*time.Second && ttl <= 100*time.Second, "unexpected ttl %v", ttl)
+		distinct[ttl] = true
+	}
+	require.True(t, len(distinct) > 1)
+
+	// deterministic with the source
+	ttls = storedTTLs(t, 1, func(handler *httpcache.CacheHandler) {
+		handler.TTLJitter = 0.1
+		handler.Rand = func() float64 { return 0.5 }
+	})
+	require.Equal(t, 95*time.Second, ttls[0])
+
+	// and disabled by default
+	ttls = storedTTLs(t, 1, func(handler *httpcache.CacheHandler) {})
+	require.Equal(t, 100*time.Second, ttls[0])
+}
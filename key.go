@@ -0,0 +1,162 @@
+package httpcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// KeyHashFunc is used to hash the built cache key into the key passed to the storage.
+//
+// A non-cryptographic hash (e.g. xxhash) is faster and shorter, but unlike SHA-256 it's not collision resistant.
+// Since a collision means one request can be answered with another request's response,
+// only use it when the keys can't be chosen by an untrusted party.
+type KeyHashFunc func(key []byte) string
+
+// SHA256KeyHash will hash the cache key with SHA-256 and return it in hex format
+func SHA256KeyHash(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])
+}
+
+// RawKey will return the cache key as it is, for a KeyHashFunc keeping the readable keys in the storage
+func RawKey(key []byte) string {
+	return string(key)
+}
+
+// keyHash will return the KeyHashFunc, SHA256KeyHash when it's nil
+func (r *CacheHandler) keyHash() KeyHashFunc {
+	if r.KeyHashFunc != nil {
+		return r.KeyHashFunc
+	}
+	return SHA256KeyHash
+}
+
+// KeyFunc build the cache key of a request, e.g. to strip some query parameters or to include a header.
+// The requests with the same key are answered with the same stored response, so it must include everything
+// the response depends on. The tenant of TenantFunc is still prepended, and the key hashed with KeyHashFunc.
+type KeyFunc func(req *http.Request) string
+
+// AuthorizationKeying decide whether the Authorization header is part of the cache key
+type AuthorizationKeying int
+
+// Authorization keying modes
+const (
+	// AuthorizationKeyingDefault folds the Authorization header in the key only for `Cache-Control: private` requests
+	AuthorizationKeyingDefault AuthorizationKeying = iota
+	// AuthorizationKeyingFold always folds the Authorization header, every credential gets its own entry
+	AuthorizationKeyingFold
+	// AuthorizationKeyingIgnore never folds the Authorization header, every credential shares the same entry
+	AuthorizationKeyingIgnore
+)
+
+// AuthorizationRoute override the AuthorizationKeying for the requests with a path matching the Pattern.
+// The Pattern follows the path.Match syntax, e.g. "/public/*".
+type AuthorizationRoute struct {
+	Pattern string
+	Keying  AuthorizationKeying
+}
+
+func (r *CacheHandler) authorizationKeying(req *http.Request) AuthorizationKeying {
+	for _, route := range r.AuthorizationRoutes {
+		if matchRoute(route.Pattern, req) {
+			return route.Keying
+		}
+	}
+	return r.AuthorizationKeying
+}
+
+// canonicalHost will return the request with the canonical host of HostAliases, or the request itself
+func (r *CacheHandler) canonicalHost(req *http.Request) *http.Request {
+	if len(r.HostAliases) == 0 {
+		return req
+	}
+	canonical, ok := r.HostAliases[strings.ToLower(req.URL.Host)]
+	if !ok {
+		// an alias without a port applies to every port
+		if canonical, ok = r.HostAliases[strings.ToLower(req.URL.Hostname())]; !ok {
+			return req
+		}
+		if port := req.URL.Port(); port != "" {
+			canonical = net.JoinHostPort(canonical, port)
+		}
+	}
+	keyReq := *req
+	keyURL := *req.URL
+	keyURL.Host = canonical
+	keyReq.URL = &keyURL
+	return &keyReq
+}
+
+func (r *CacheHandler) cacheKey(req *http.Request) (key string) {
+	if r.KeyFunc != nil {
+		key = r.KeyFunc(req)
+	} else {
+		keyReq := r.canonicalHost(req)
+		if r.NormalizeKey {
+			keyReq = normalizedURL(keyReq)
+		}
+		key = getCacheKey(keyReq, r.authorizationKeying(req))
+	}
+	if r.TenantFunc != nil {
+		// length-prefixed, so the tenant "a/b" can't collide with the tenant "a" and a key starting with "b"
+		tenant := r.TenantFunc(req.Context())
+		key = fmt.Sprintf("%d:%s %s", len(tenant), tenant, key)
+	}
+	return r.keyHash()([]byte(key))
+}
+
+// defaultPorts are the ports omitted from a normalized URL, by scheme
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// normalizedURL will return the request with its normalized URL, see CacheHandler.NormalizeKey.
+// The values of a repeated query parameter keep their order, it can be meaningful.
+func normalizedURL(req *http.Request) *http.Request {
+	keyURL := *req.URL
+	keyURL.Scheme = strings.ToLower(keyURL.Scheme)
+	keyURL.Host = strings.ToLower(keyURL.Host)
+	if port := keyURL.Port(); port != "" && port == defaultPorts[keyURL.Scheme] {
+		keyURL.Host = strings.TrimSuffix(keyURL.Host, ":"+port)
+	}
+	if keyURL.Path == "" {
+		keyURL.Path = "/"
+	}
+	if query, err := url.ParseQuery(keyURL.RawQuery); err == nil {
+		keyURL.RawQuery = query.Encode() // sorted by name
+	}
+	keyURL.ForceQuery = false
+	keyReq := *req
+	keyReq.URL = &keyURL
+	return &keyReq
+}
+
+// TenantFunc extract the tenant of a request from its context, see CacheHandler.TenantFunc
+type TenantFunc func(ctx context.Context) string
+
+// hasAbsoluteURL will check if the request URL is complete enough to build a collision-free cache key
+func hasAbsoluteURL(req *http.Request) bool {
+	return req.URL != nil && req.URL.Scheme != "" && req.URL.Host != ""
+}
+
+// getCacheKey will build the key of the request. The Cookie header is never part of it, the requests
+// with different cookies share the same entry.
+func getCacheKey(req *http.Request, authKeying AuthorizationKeying) (key string) {
+	key = fmt.Sprintf("%s %s", req.Method, req.URL.String())
+	if req.Header.Get(HeaderAuthorization) == "" {
+		return
+	}
+	switch authKeying {
+	case AuthorizationKeyingFold:
+		key = fmt.Sprintf("%s %s", key, req.Header.Get(HeaderAuthorization))
+	case AuthorizationKeyingDefault:
+		if strings.ToLower(req.Header.Get(HeaderCacheControl)) == "private" {
+			key = fmt.Sprintf("%s %s", key, req.Header.Get(HeaderAuthorization))
+		}
+	}
+	return
+}
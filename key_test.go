@@ -0,0 +1,335 @@
+package httpcache_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/bxcodec/httpcache/cache"
+	"github.com/bxcodec/httpcache/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustomKeyHashFunc(t *testing.T) {
+	server, _ := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+
+	fnvHash := func(key []byte) string {
+		h := fnv.New64a()
+		_, _ = h.Write(key)
+		return fmt.Sprintf("%x", h.Sum64())
+	}
+	expectedKey := fnvHash([]byte("GET " + server.URL))
+
+	mockCacheInteractor := new(mocks.ICacheInteractor)
+	mockCacheInteractor.On("Get", expectedKey).Twice().Return(cache.CachedResponse{}, errors.New("uknown error"))
+	mockCacheInteractor.On("Set", expectedKey, mock.Anything, mock.Anything).Twice().Return(nil)
+
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, mockCacheInteractor)
+	handler.KeyHashFunc = fnvHash
+	client := &http.Client{Transport: handler}
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		doRequest(t, client, req)
+	}
+	mockCacheInteractor.AssertExpectations(t)
+}
+
+func TestDefaultKeyHash(t *testing.T) {
+	server, _ := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+
+	// hashed with SHA-256 when KeyHashFunc is nil
+	expectedKey := httpcache.SHA256KeyHash([]byte("GET " + server.URL))
+	mockCacheInteractor := new(mocks.ICacheInteractor)
+	mockCacheInteractor.On("Get", expectedKey).Once().Return(cache.CachedResponse{}, cache.ErrCacheMissed)
+	mockCacheInteractor.On("Set", expectedKey, mock.Anything, mock.Anything).Once().Return(nil)
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, mockCacheInteractor)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, &http.Client{Transport: handler}, req)
+	mockCacheInteractor.AssertExpectations(t)
+}
+
+func TestSHA256KeyHash(t *testing.T) {
+	key := httpcache.SHA256KeyHash([]byte("GET http://bxcodec.io"))
+	require.Len(t, key, 64)
+	require.Equal(t, key, httpcache.SHA256KeyHash([]byte("GET http://bxcodec.io")))
+	require.NotEqual(t, key, httpcache.SHA256KeyHash([]byte("HEAD http://bxcodec.io")))
+}
+
+func TestAuthorizationRoutes(t *testing.T) {
+	server, hits := newCountingServer(t, "public, max-age=3600")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.AuthorizationRoutes = []httpcache.AuthorizationRoute{
+		{Pattern: "/public/*", Keying: httpcache.AuthorizationKeyingIgnore},
+	}
+	client := &http.Client{Transport: handler}
+
+	doAuthorizedRequest := func(path, token string) string {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set(httpcache.HeaderCacheControl, "private")
+		req.Header.Set(httpcache.HeaderAuthorization, token)
+		_, body := doRequest(t, client, req)
+		return body
+	}
+
+	// the default keying folds the token for private requests
+	require.Equal(t, "1", doAuthorizedRequest("/private/item", "Bearer a"))
+	require.Equal(t, "2", doAuthorizedRequest("/private/item", "Bearer b"))
+	require.Equal(t, "1", doAuthorizedRequest("/private/item", "Bearer a"))
+
+	// the public route ignores the token, so every caller shares the entry
+	require.Equal(t, "3", doAuthorizedRequest("/public/item", "Bearer a"))
+	require.Equal(t, "3", doAuthorizedRequest("/public/item", "Bearer b"))
+	require.EqualValues(t, 3, *hits)
+}
+
+func TestMalformedRequestURLBypassCache(t *testing.T) {
+	mockCacheInteractor := new(mocks.ICacheInteractor)
+	hits := 0
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		hits++
+		return nil, errors.New("unsupported request")
+	})
+	handler := httpcache.NewCacheHandlerRoundtrip(transport, true, mockCacheInteractor)
+
+	schemeRelative, err := http.NewRequest(http.MethodGet, "//bxcodec.io/hello", nil)
+	require.NoError(t, err)
+	requests := []*http.Request{
+		{Method: http.MethodGet, Header: http.Header{}},
+		schemeRelative,
+	}
+	for _, req := range requests {
+		require.NotPanics(t, func() {
+			_, err = handler.RoundTrip(req)
+		})
+		require.Error(t, err)
+	}
+
+	require.Equal(t, len(requests), hits)
+	// the storage must never be touched
+	mockCacheInteractor.AssertExpectations(t)
+}
+
+type tenantContextKey struct{}
+
+func TestTenantIsolation(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.TenantFunc = func(ctx context.Context) string {
+		tenant, _ := ctx.Value(tenantContextKey{}).(string)
+		return tenant
+	}
+	client := &http.Client{Transport: handler}
+
+	doTenantRequest := func(tenant string) string {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		if tenant != "" {
+			req = req.WithContext(context.WithValue(req.Context(), tenantContextKey{}, tenant))
+		}
+		_, body := doRequest(t, client, req)
+		return body
+	}
+
+	require.Equal(t, "1", doTenantRequest("a"))
+	require.Equal(t, "2", doTenantRequest("b"))
+	require.Equal(t, "1", doTenantRequest("a"))
+	require.Equal(t, "2", doTenantRequest("b"))
+
+	// without a tenant, the cache is never read nor written
+	require.Equal(t, "3", doTenantRequest(""))
+	require.Equal(t, "4", doTenantRequest(""))
+	require.EqualValues(t, 4, *hits)
+	require.Len(t, listDebugEntries(t, httpcache.DebugHandler(handler)), 2)
+}
+
+func TestTenantKeyNoCollision(t *testing.T) {
+	server, _ := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	mockCacheInteractor := new(mocks.ICacheInteractor)
+	mockCacheInteractor.On("Get", "3:a/b GET "+server.URL).Once().Return(cache.CachedResponse{}, errors.New("uknown error"))
+	mockCacheInteractor.On("Set", "3:a/b GET "+server.URL, mock.Anything, mock.Anything).Once().Return(nil)
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, mockCacheInteractor)
+	handler.KeyHashFunc = httpcache.RawKey
+	handler.TenantFunc = func(ctx context.Context) string {
+		return "a/b"
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, &http.Client{Transport: handler}, req)
+	mockCacheInteractor.AssertExpectations(t)
+}
+
+func TestCookiesIgnored(t *testing.T) {
+	server, hits := newCountingServer(t, "public, max-age=3600")
+	defer server.Close()
+	client := &http.Client{
+		Transport: httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache()),
+	}
+
+	for i, cookie := range []string{"session=alice", "session=bob; theme=dark", ""} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/public/home", nil)
+		require.NoError(t, err)
+		if cookie != "" {
+			req.Header.Set("Cookie", cookie)
+		}
+		resp, body := doRequest(t, client, req)
+		require.Equal(t, "1", body)
+		if i > 0 {
+			require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+		}
+	}
+	require.EqualValues(t, 1, *hits)
+}
+
+func TestDistinctURLKeys(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.KeyHashFunc = httpcache.RawKey
+	client := &http.Client{Transport: handler}
+
+	// the HEAD request goes first, the cached GET would answer it
+	for _, target := range []struct{ method, path string }{
+		{http.MethodHead, "/a"},
+		{http.MethodGet, "/a"},
+		{http.MethodGet, "/b"},
+		{http.MethodGet, "/a"},
+	} {
+		req, err := http.NewRequest(target.method, server.URL+target.path, nil)
+		require.NoError(t, err)
+		doRequest(t, client, req)
+	}
+
+	keys := map[string]bool{}
+	for _, entry := range listDebugEntries(t, httpcache.DebugHandler(handler)) {
+		keys[entry.Key] = true
+	}
+	require.Equal(t, map[string]bool{
+		"GET " + server.URL + "/a":  true,
+		"GET " + server.URL + "/b":  true,
+		"HEAD " + server.URL + "/a": true,
+	}, keys)
+	require.EqualValues(t, 3, *hits)
+}
+
+func TestHostAliases(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	// every host is sent to the test server
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.URL.Host = serverURL.Host
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	handler := httpcache.NewCacheHandlerRoundtrip(transport, true, newInmemCache())
+	handler.HostAliases = map[string]string{"api.internal": "api", "10.0.0.5": "api"}
+	client := &http.Client{Transport: handler}
+
+	for _, target := range []struct{ host, body string }{
+		{"api.internal", "1"},
+		{"10.0.0.5", "1"},
+		{"API.internal", "1"},
+		{"api", "1"},
+		{"other.internal", "2"},
+		{"10.0.0.5:8080", "3"},
+		{"api:8080", "3"},
+	} {
+		req, err := http.NewRequest(http.MethodGet, "http://"+target.host+"/products", nil)
+		require.NoError(t, err)
+		_, body := doRequest(t, client, req)
+		require.Equal(t, target.body, body, target.host)
+	}
+	require.EqualValues(t, 3, *hits)
+}
+
+func TestNormalizeKey(t *testing.T) {
+	for _, normalized := range []bool{true, false} {
+		server, hits := newCountingServer(t, "max-age=3600")
+		serverURL, err := url.Parse(server.URL)
+		require.NoError(t, err)
+		// every host is sent to the test server
+		transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.URL.Host = serverURL.Host
+			return http.DefaultTransport.RoundTrip(req)
+		})
+		handler := httpcache.NewCacheHandlerRoundtrip(transport, true, newInmemCache())
+		handler.NormalizeKey = normalized
+		handler.KeyHashFunc = httpcache.RawKey
+		client := &http.Client{Transport: handler}
+
+		for _, target := range []string{
+			"http://api.example.com/products?b=2&a=1",
+			"http://api.example.com/products?a=1&b=2",
+			"http://API.example.com:80/products?a=1&b=2",
+		} {
+			req, err := http.NewRequest(http.MethodGet, target, nil)
+			require.NoError(t, err)
+			doRequest(t, client, req)
+		}
+		// the values of a repeated parameter keep their order
+		for _, target := range []string{"http://api.example.com/?a=1&a=2", "http://api.example.com?a=2&a=1"} {
+			req, err := http.NewRequest(http.MethodGet, target, nil)
+			require.NoError(t, err)
+			doRequest(t, client, req)
+		}
+
+		if normalized {
+			require.EqualValues(t, 3, *hits)
+			keys := []string{}
+			for _, entry := range listDebugEntries(t, httpcache.DebugHandler(handler)) {
+				keys = append(keys, entry.Key)
+			}
+			require.ElementsMatch(t, []string{
+				"GET http://api.example.com/products?a=1&b=2",
+				"GET http://api.example.com/?a=1&a=2",
+				"GET http://api.example.com/?a=2&a=1",
+			}, keys)
+		} else {
+			require.EqualValues(t, 5, *hits)
+		}
+		server.Close()
+	}
+}
+
+func TestKeyFunc(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.KeyFunc = func(req *http.Request) string {
+		// the query string is ignored
+		return req.Method + " " + req.URL.Scheme + "://" + req.URL.Host + req.URL.Path
+	}
+	client := &http.Client{Transport: handler}
+
+	for _, target := range []struct{ path, body string }{
+		{"/products?utm_source=mail", "1"},
+		{"/products?utm_source=ads", "1"},
+		{"/products", "1"},
+		{"/orders?utm_source=mail", "2"},
+	} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+target.path, nil)
+		require.NoError(t, err)
+		_, body := doRequest(t, client, req)
+		require.Equal(t, target.body, body, target.path)
+	}
+	require.EqualValues(t, 2, *hits)
+}
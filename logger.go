@@ -0,0 +1,18 @@
+package httpcache
+
+// Logger is the destination of the handler logs, e.g. a *log.Logger
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// nopLogger discards every log, it's the default Logger
+type nopLogger struct{}
+
+func (nopLogger) Printf(format string, args ...interface{}) {}
+
+func (r *CacheHandler) logger() Logger {
+	if r.Logger != nil {
+		return r.Logger
+	}
+	return nopLogger{}
+}
@@ -0,0 +1,45 @@
+package httpcache_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/bxcodec/httpcache/cache"
+	"github.com/bxcodec/httpcache/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type capturingLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *capturingLogger) Printf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, fmt.Sprintf(format, args...))
+}
+
+func TestLogger(t *testing.T) {
+	server, _ := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	mockCacheInteractor := new(mocks.ICacheInteractor)
+	mockCacheInteractor.On("Get", mock.AnythingOfType("string")).Return(cache.CachedResponse{}, errors.New("connection refused"))
+	mockCacheInteractor.On("Set", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(nil)
+	logger := &capturingLogger{}
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, mockCacheInteractor)
+	handler.Logger = logger
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, &http.Client{Transport: handler}, req)
+	require.Len(t, logger.logs, 1)
+	require.True(t, strings.Contains(logger.logs[0], "connection refused"), logger.logs[0])
+	require.True(t, strings.Contains(logger.logs[0], "failed to retrieve from cache"), logger.logs[0])
+}
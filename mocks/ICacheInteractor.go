@@ -5,6 +5,8 @@ package mocks
 import (
 	cache "github.com/bxcodec/httpcache/cache"
 	mock "github.com/stretchr/testify/mock"
+
+	time "time"
 )
 
 // ICacheInteractor is an autogenerated mock type for the ICacheInteractor type
@@ -75,13 +77,13 @@ func (_m *ICacheInteractor) Origin() string {
 	return r0
 }
 
-// Set provides a mock function with given fields: key, value
-func (_m *ICacheInteractor) Set(key string, value cache.CachedResponse) error {
-	ret := _m.Called(key, value)
+// Set provides a mock function with given fields: key, value, ttl
+func (_m *ICacheInteractor) Set(key string, value cache.CachedResponse, ttl time.Duration) error {
+	ret := _m.Called(key, value, ttl)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string, cache.CachedResponse) error); ok {
-		r0 = rf(key, value)
+	if rf, ok := ret.Get(0).(func(string, cache.CachedResponse, time.Duration) error); ok {
+		r0 = rf(key, value, ttl)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -0,0 +1,22 @@
+package httpcache
+
+import (
+	"net/http"
+	"time"
+)
+
+// negativeTTL will return the NegativeCache lifetime of the response status code. It's false when the status
+// isn't negatively cached, or when the request or the response has an explicit no-store.
+func (r *CacheHandler) negativeTTL(req *http.Request, resp *http.Response) (time.Duration, bool) {
+	ttl, ok := r.NegativeCache[resp.StatusCode]
+	if !ok || ttl <= 0 {
+		return 0, false
+	}
+	if respDir, err := ParseResponseDirectives(resp); err != nil || respDir.NoStore {
+		return 0, false
+	}
+	if reqDir, err := ParseRequestDirectives(req); err != nil || reqDir.NoStore {
+		return 0, false
+	}
+	return ttl, true
+}
@@ -0,0 +1,97 @@
+package httpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegativeCache(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path == "/down" {
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	clock := &fakeClock{now: time.Now()}
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.Clock = clock.Now
+	handler.CacheableStatusCodes = map[int]bool{http.StatusOK: true}
+	handler.NegativeCache = map[int]time.Duration{
+		http.StatusNotFound:           10 * time.Second,
+		http.StatusServiceUnavailable: 10 * time.Second,
+	}
+	client := &http.Client{Transport: handler}
+
+	// stored without cacheability headers, and even if it's not a cacheable status code
+	notFound, err := http.NewRequest(http.MethodGet, server.URL+"/missing", nil)
+	require.NoError(t, err)
+	doRequest(t, client, notFound)
+	clock.Advance(10 * time.Second)
+	resp, _ := doRequest(t, client, notFound)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, 1, hits)
+
+	// refetched once its lifetime is over
+	clock.Advance(time.Nanosecond)
+	resp, _ = doRequest(t, client, notFound)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, 2, hits)
+
+	// an explicit no-store is still respected
+	down, err := http.NewRequest(http.MethodGet, server.URL+"/down", nil)
+	require.NoError(t, err)
+	doRequest(t, client, down)
+	resp, _ = doRequest(t, client, down)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, 4, hits)
+}
+
+func TestNegativeCacheSharedPrivacy(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "private")
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.Shared = true
+	handler.NegativeCache = map[int]time.Duration{http.StatusNotFound: 10 * time.Second}
+	client := &http.Client{Transport: handler}
+
+	// the negative entries of a shared cache still respect the privacy of the responses
+	private, err := http.NewRequest(http.MethodGet, server.URL+"/private", nil)
+	require.NoError(t, err)
+	authorized, err := http.NewRequest(http.MethodGet, server.URL+"/authorized", nil)
+	require.NoError(t, err)
+	authorized.Header.Set("Authorization", "Bearer token")
+	for i, req := range []*http.Request{private, private, authorized, authorized} {
+		resp, _ := doRequest(t, client, req)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+		require.Equal(t, i+1, hits)
+	}
+
+	// the other ones are stored
+	missing, err := http.NewRequest(http.MethodGet, server.URL+"/missing", nil)
+	require.NoError(t, err)
+	doRequest(t, client, missing)
+	resp, _ := doRequest(t, client, missing)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, 5, hits)
+}
@@ -0,0 +1,29 @@
+package httpcache
+
+// Observer is notified of the cache events of the handler, e.g. to export the hit ratio as metrics.
+// It's called synchronously by RoundTrip, so it must be fast and safe for a concurrent use.
+type Observer interface {
+	// OnHit is called when the lookup of the key is served from the cache
+	OnHit(key string)
+	// OnMiss is called when the lookup of the key isn't served from the cache, e.g. missing or expired
+	OnMiss(key string)
+	// OnStore is called when a response is stored under the key
+	OnStore(key string)
+	// OnError is called when the cache storage failed for the key
+	OnError(key string, err error)
+}
+
+// nopObserver ignores every event, it's the default Observer
+type nopObserver struct{}
+
+func (nopObserver) OnHit(key string)              {}
+func (nopObserver) OnMiss(key string)             {}
+func (nopObserver) OnStore(key string)            {}
+func (nopObserver) OnError(key string, err error) {}
+
+func (r *CacheHandler) observer() Observer {
+	if r.Observer != nil {
+		return r.Observer
+	}
+	return nopObserver{}
+}
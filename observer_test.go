@@ -0,0 +1,81 @@
+package httpcache_test
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/bxcodec/httpcache/cache"
+	"github.com/stretchr/testify/require"
+)
+
+// countingObserver count the events of the handler
+type countingObserver struct {
+	mu                         sync.Mutex
+	hits, misses, stores, errs int
+}
+
+func (o *countingObserver) OnHit(key string)              { o.count(&o.hits) }
+func (o *countingObserver) OnMiss(key string)             { o.count(&o.misses) }
+func (o *countingObserver) OnStore(key string)            { o.count(&o.stores) }
+func (o *countingObserver) OnError(key string, err error) { o.count(&o.errs) }
+
+func (o *countingObserver) count(n *int) {
+	o.mu.Lock()
+	*n++
+	o.mu.Unlock()
+}
+
+func TestObserver(t *testing.T) {
+	server, _ := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	observer := &countingObserver{}
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.Observer = observer
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	require.Equal(t, 0, observer.hits)
+	require.Equal(t, 1, observer.misses)
+	require.Equal(t, 1, observer.stores)
+
+	doRequest(t, client, req)
+	require.Equal(t, 1, observer.hits)
+	require.Equal(t, 1, observer.misses)
+	require.Equal(t, 1, observer.stores)
+	require.Equal(t, 0, observer.errs)
+}
+
+// failingCache fails every operation
+type failingCache struct{ cache.ICacheInteractor }
+
+func (failingCache) Get(key string) (cache.CachedResponse, error) {
+	return cache.CachedResponse{}, errors.New("down")
+}
+
+func (failingCache) Set(key string, value cache.CachedResponse, ttl time.Duration) error {
+	return errors.New("down")
+}
+
+func TestObserverErrors(t *testing.T) {
+	server, _ := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	observer := &countingObserver{}
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, failingCache{newInmemCache()})
+	handler.Observer = observer
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	// the failing lookup and the failing store
+	_, body := doRequest(t, client, req)
+	require.Equal(t, "1", body)
+	require.Equal(t, 1, observer.misses)
+	require.Equal(t, 0, observer.stores)
+	require.Equal(t, 2, observer.errs)
+}
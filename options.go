@@ -0,0 +1,124 @@
+package httpcache
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bxcodec/httpcache/cache"
+)
+
+// Option configure the CacheHandler built by New
+type Option func(*CacheHandler)
+
+// New will create the cache http roundtripper on the cache storage, configured with the options.
+// It fetches the origin with http.DefaultTransport and complies with RFC 7234 as a shared cache unless the options
+// say otherwise, the other fields keep their zero value.
+func New(cacheActor cache.ICacheInteractor, opts ...Option) *CacheHandler {
+	if cacheActor == nil {
+		log.Fatal("cache storage is not well set")
+	}
+	handler := &CacheHandler{
+		DefaultRoundTripper: http.DefaultTransport,
+		CacheInteractor:     cacheActor,
+		ComplyRFC:           true,
+		Shared:              true,
+	}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	return handler
+}
+
+// WithTransport will fetch the origin with the roundtripper, see CacheHandler.DefaultRoundTripper
+func WithTransport(rt http.RoundTripper) Option {
+	return func(r *CacheHandler) { r.DefaultRoundTripper = rt }
+}
+
+// WithRevalidationTransport will send the revalidation requests with the roundtripper,
+// see CacheHandler.RevalidationRoundTripper
+func WithRevalidationTransport(rt http.RoundTripper) Option {
+	return func(r *CacheHandler) { r.RevalidationRoundTripper = rt }
+}
+
+// WithRFCCompliance will enable or disable the RFC 7234 compliance, enabled by default
+func WithRFCCompliance(val bool) Option {
+	return func(r *CacheHandler) { r.ComplyRFC = val }
+}
+
+// WithName will identify the handler in the cached responses, see CacheHandler.Name
+func WithName(name string) Option {
+	return func(r *CacheHandler) { r.Name = name }
+}
+
+// WithHeaderNames will rename the headers added to the cached responses, see CacheHandler.HeaderNames
+func WithHeaderNames(names HeaderNames) Option {
+	return func(r *CacheHandler) { r.HeaderNames = names }
+}
+
+// WithShared will make the cache shared or private, shared by default, see CacheHandler.Shared
+func WithShared(shared bool) Option {
+	return func(r *CacheHandler) { r.Shared = shared }
+}
+
+// WithLogger will send the handler logs to the logger, see CacheHandler.Logger
+func WithLogger(logger Logger) Option {
+	return func(r *CacheHandler) { r.Logger = logger }
+}
+
+// WithObserver will notify the cache events to the observer, see CacheHandler.Observer
+func WithObserver(observer Observer) Option {
+	return func(r *CacheHandler) { r.Observer = observer }
+}
+
+// WithKeyFunc will replace the built-in cache key, see CacheHandler.KeyFunc
+func WithKeyFunc(fn KeyFunc) Option {
+	return func(r *CacheHandler) { r.KeyFunc = fn }
+}
+
+// WithVaryNormalizer will canonicalize the values selecting the variants, see CacheHandler.VaryNormalizer
+func WithVaryNormalizer(fn VaryNormalizerFunc) Option {
+	return func(r *CacheHandler) { r.VaryNormalizer = fn }
+}
+
+// WithKeyHash will hash the cache keys, see CacheHandler.KeyHashFunc
+func WithKeyHash(fn KeyHashFunc) Option {
+	return func(r *CacheHandler) { r.KeyHashFunc = fn }
+}
+
+// WithClock will use the clock for the freshness computations, see CacheHandler.Clock
+func WithClock(clock func() time.Time) Option {
+	return func(r *CacheHandler) { r.Clock = clock }
+}
+
+// WithDefaultTTL will store the responses without any caching header for the ttl, see CacheHandler.DefaultTTL
+func WithDefaultTTL(ttl time.Duration) Option {
+	return func(r *CacheHandler) { r.DefaultTTL = ttl }
+}
+
+// WithMaxTTL will cap the lifetime of the stored responses, see CacheHandler.MaxTTL
+func WithMaxTTL(ttl time.Duration) Option {
+	return func(r *CacheHandler) { r.MaxTTL = ttl }
+}
+
+// WithMaxBodyBytes will pass the responses with a larger body through uncached, see CacheHandler.MaxBodyBytes
+func WithMaxBodyBytes(n int64) Option {
+	return func(r *CacheHandler) { r.MaxBodyBytes = n }
+}
+
+// WithCompression will compress the stored responses with the codec, or disable the compression
+// with CodecNone, see CacheHandler.Compression
+func WithCompression(codec string) Option {
+	return func(r *CacheHandler) { r.Compression, r.CompressionCodec = codec != CodecNone, codec }
+}
+
+// WithMaxStaleServe will cap how long the expired entries are served, see CacheHandler.MaxStaleServe
+func WithMaxStaleServe(d time.Duration) Option {
+	return func(r *CacheHandler) { r.MaxStaleServe = d }
+}
+
+// WithMaxBackgroundRevalidations will cap the revalidations running in the background,
+// see CacheHandler.MaxBackgroundRevalidations
+func WithMaxBackgroundRevalidations(n int) Option {
+	return func(r *CacheHandler) { r.MaxBackgroundRevalidations = n }
+}
@@ -0,0 +1,77 @@
+package httpcache_test
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDefaults(t *testing.T) {
+	handler := httpcache.New(newInmemCache())
+	require.Equal(t, http.DefaultTransport, handler.DefaultRoundTripper)
+	require.True(t, handler.ComplyRFC)
+	require.True(t, handler.Shared)
+}
+
+func TestNewOptions(t *testing.T) {
+	server, hits := newCountingServer(t, "")
+	defer server.Close()
+	var transported int
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		transported++
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	var logs bytes.Buffer
+	observer := &countingObserver{}
+	clock := &fakeClock{now: time.Now()}
+	handler := httpcache.New(newInmemCache(),
+		httpcache.WithTransport(transport),
+		httpcache.WithRevalidationTransport(http.DefaultTransport),
+		httpcache.WithRFCCompliance(false),
+		httpcache.WithLogger(log.New(&logs, "", 0)),
+		httpcache.WithObserver(observer),
+		httpcache.WithKeyFunc(func(req *http.Request) string { return "key " + req.URL.Path }),
+		httpcache.WithKeyHash(httpcache.SHA256KeyHash),
+		httpcache.WithClock(clock.Now),
+		httpcache.WithDefaultTTL(time.Hour),
+		httpcache.WithMaxTTL(time.Minute),
+		httpcache.WithMaxBodyBytes(1024),
+	)
+	require.False(t, handler.ComplyRFC)
+	require.Equal(t, time.Hour, handler.DefaultTTL)
+	require.Equal(t, time.Minute, handler.MaxTTL)
+	require.EqualValues(t, 1024, handler.MaxBodyBytes)
+	require.Equal(t, http.DefaultTransport, handler.RevalidationRoundTripper)
+	client := &http.Client{Transport: handler}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/a", nil)
+	require.NoError(t, err)
+	// stored with the DefaultTTL capped by the MaxTTL, through the transport, logging the miss
+	doRequest(t, client, req)
+	require.Equal(t, 1, transported)
+	require.NotEmpty(t, logs.String())
+	require.Equal(t, 1, observer.stores)
+
+	// the query is not part of the custom key
+	other, err := http.NewRequest(http.MethodGet, server.URL+"/a?b=c", nil)
+	require.NoError(t, err)
+	resp, body := doRequest(t, client, other)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "1", body)
+
+	entries := listDebugEntries(t, httpcache.DebugHandler(handler))
+	require.Len(t, entries, 1)
+	require.Equal(t, httpcache.SHA256KeyHash([]byte("key /a")), entries[0].Key)
+	require.Equal(t, time.Minute, entries[0].ExpiresAt.Sub(entries[0].CachedTime))
+
+	// the entry expires on the clock
+	clock.Advance(time.Minute + time.Second)
+	resp, _ = doRequest(t, client, req)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.EqualValues(t, 2, *hits)
+}
@@ -0,0 +1,168 @@
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/bxcodec/httpcache/cache"
+)
+
+// BodyPolicyFunc decide from the response body whether a response can be stored, and for how long.
+// A zero ttl keeps the freshness computed from the response headers.
+//
+// To inspect it, the whole response body is buffered in memory before it's returned to the caller,
+// so every response (including the uncacheable ones) costs its full body size while it's being decided.
+type BodyPolicyFunc func(req *http.Request, resp *http.Response, body []byte) (store bool, ttl time.Duration)
+
+// HitAction is the decision of a HitPolicyFunc on a cache hit
+type HitAction int
+
+// Hit actions
+const (
+	// HitActionServe serves the stored response
+	HitActionServe HitAction = iota
+	// HitActionRevalidate fetches the origin and stores the new response. A stored response with a validator is
+	// revalidated with a conditional request, and served again on a 304.
+	HitActionRevalidate
+	// HitActionBypass fetches the origin without storing the response, the stored one is kept
+	HitActionBypass
+)
+
+// HitPolicyFunc decide what to do on every cache hit, i.e. a stored response fresh enough to be served.
+// It can be used as a runtime switch, e.g. to refetch the price entries on every hit during a sale.
+type HitPolicyFunc func(req *http.Request, entry cache.CachedResponse) HitAction
+
+func (r *CacheHandler) hitAction(req *http.Request, entry cache.CachedResponse) HitAction {
+	if r.HitPolicyFunc == nil {
+		return HitActionServe
+	}
+	return r.HitPolicyFunc(req, entry)
+}
+
+// TTLBySizeFunc return the lifetime of a stored response from its body size in bytes, and the lifetime computed
+// from its headers and the other policies. The result is still capped by MaxTTL, and a zero result keeps
+// the freshness from the response headers.
+//
+// When the response has no Content-Length, its body is buffered in memory to be measured.
+type TTLBySizeFunc func(bytes int64, computed time.Duration) time.Duration
+
+func (r *CacheHandler) scaleTTLBySize(req *http.Request, resp *http.Response, ttl time.Duration) (time.Duration, error) {
+	size := resp.ContentLength
+	if size < 0 {
+		body, err := bufferBody(resp)
+		if err != nil {
+			return 0, err
+		}
+		size = int64(len(body))
+	}
+	computed := ttl
+	if computed == 0 {
+		computed = r.headerFreshness(req, resp)
+	}
+	return r.TTLBySize(size, computed), nil
+}
+
+func (r *CacheHandler) applyBodyPolicy(req *http.Request, resp *http.Response) (store bool, ttl time.Duration, err error) {
+	body, err := bufferBody(resp)
+	if err != nil {
+		return
+	}
+	store, ttl = r.BodyPolicyFunc(req, resp, body)
+	return
+}
+
+// bufferBody will read the whole response body, and restore it for the caller
+func bufferBody(resp *http.Response) (body []byte, err error) {
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		// let the caller still read what was buffered, and the failure itself
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return
+	}
+	if err = resp.Body.Close(); err != nil {
+		return
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return
+}
+
+// verifyReplay will check the dumped response can be read back with the same body length
+func verifyReplay(dumpedResponse []byte, req *http.Request, bodyLength int) error {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(dumpedResponse)), req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	replayedLength, err := io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		return err
+	}
+	if replayedLength != int64(bodyLength) {
+		return fmt.Errorf("replayed body length %d doesn't match the response body length %d", replayedLength, bodyLength)
+	}
+	return nil
+}
+
+// identicalStoredResponse will return the stored dumped response when its body is identical to the new one,
+// otherwise the new dumped response is returned.
+func (r *CacheHandler) identicalStoredResponse(key string, dumpedResponse []byte) []byte {
+	stored, err := r.CacheInteractor.Get(key)
+	if err == nil {
+		stored, err = decompressEntry(stored)
+	}
+	if err != nil {
+		return dumpedResponse
+	}
+	storedHash, err := dumpedBodyHash(stored.DumpedResponse)
+	if err != nil {
+		return dumpedResponse
+	}
+	newHash, err := dumpedBodyHash(dumpedResponse)
+	if err != nil || storedHash != newHash {
+		return dumpedResponse
+	}
+	return stored.DumpedResponse
+}
+
+func dumpedBodyHash(dumpedResponse []byte) (sum [sha256.Size]byte, err error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(dumpedResponse)), nil)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, resp.Body); err != nil {
+		return
+	}
+	copy(sum[:], hash.Sum(nil))
+	return
+}
+
+// headerSize will return the size of the header in the wire format, i.e. each `Name: value\r\n` line
+func headerSize(header http.Header) (size int) {
+	for name, values := range header {
+		for _, value := range values {
+			size += len(name) + len(": ") + len(value) + len("\r\n")
+		}
+	}
+	return
+}
+
+// hasCacheabilityInfo will check if the response headers carry any freshness or validation information
+func hasCacheabilityInfo(header http.Header) bool {
+	for _, name := range []string{HeaderCacheControl, "Expires", "Last-Modified", "ETag"} {
+		if header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
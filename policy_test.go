@@ -0,0 +1,354 @@
+package httpcache_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/bxcodec/httpcache/cache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodyPolicyFunc(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "application/json")
+		maxAge, _ := strconv.Atoi(r.URL.Query().Get("maxAge"))
+		fmt.Fprintf(w, `{"data":{"hits":%d},"extensions":{"cacheControl":{"maxAge":%d}}}`, hits, maxAge)
+	}))
+	defer server.Close()
+
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.BodyPolicyFunc = func(req *http.Request, resp *http.Response, body []byte) (bool, time.Duration) {
+		var payload struct {
+			Extensions struct {
+				CacheControl struct {
+					MaxAge int `json:"maxAge"`
+				} `json:"cacheControl"`
+			} `json:"extensions"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil || payload.Extensions.CacheControl.MaxAge <= 0 {
+			return false, 0
+		}
+		return true, time.Duration(payload.Extensions.CacheControl.MaxAge) * time.Second
+	}
+	client := &http.Client{Transport: handler}
+
+	uncacheable, err := http.NewRequest(http.MethodGet, server.URL+"/graphql?maxAge=0", nil)
+	require.NoError(t, err)
+	doRequest(t, client, uncacheable)
+	resp, body := doRequest(t, client, uncacheable)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.JSONEq(t, `{"data":{"hits":2},"extensions":{"cacheControl":{"maxAge":0}}}`, body)
+
+	// the response carries no freshness header, only the TTL from the body makes it servable
+	cacheable, err := http.NewRequest(http.MethodGet, server.URL+"/graphql?maxAge=60", nil)
+	require.NoError(t, err)
+	_, body = doRequest(t, client, cacheable)
+	require.JSONEq(t, `{"data":{"hits":3},"extensions":{"cacheControl":{"maxAge":60}}}`, body)
+	resp, body = doRequest(t, client, cacheable)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.JSONEq(t, `{"data":{"hits":3},"extensions":{"cacheControl":{"maxAge":60}}}`, body)
+	require.Equal(t, 3, hits)
+}
+
+func TestKeepIdenticalEntries(t *testing.T) {
+	hits := 0
+	body := "hello"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, hits))
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	for _, keep := range []bool{true, false} {
+		hits = 0
+		body = "hello"
+		handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+		handler.KeepIdenticalEntries = keep
+		client := &http.Client{Transport: handler}
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+
+		doRequest(t, client, req)
+		doRequest(t, client, httpcache.ForceReload(req))
+		resp, _ := doRequest(t, client, req)
+		require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+		if keep {
+			require.Equal(t, `"1"`, resp.Header.Get("ETag"))
+		} else {
+			require.Equal(t, `"2"`, resp.Header.Get("ETag"))
+		}
+
+		// a changed body always replaces the stored entry
+		body = "hello world"
+		doRequest(t, client, httpcache.ForceReload(req))
+		resp, respBody := doRequest(t, client, req)
+		require.Equal(t, `"3"`, resp.Header.Get("ETag"))
+		require.Equal(t, "hello world", respBody)
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	server, hits := newCountingServer(t, "")
+	defer server.Close()
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	doRequest(t, client, req)
+	_, body := doRequest(t, client, req)
+	require.Equal(t, "2", body)
+
+	handler.DefaultTTL = time.Minute
+	doRequest(t, client, req)
+	resp, body := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "3", body)
+	require.EqualValues(t, 3, *hits)
+
+	entries := listDebugEntries(t, httpcache.DebugHandler(handler))
+	require.Len(t, entries, 1)
+	require.Equal(t, entries[0].CachedTime.Add(time.Minute), entries[0].ExpiresAt)
+}
+
+func TestVerifyOnStore(t *testing.T) {
+	// a body on a 204 is dropped when the dumped response is read back
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode:    http.StatusNoContent,
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Cache-Control": []string{"max-age=3600"}},
+			ContentLength: -1,
+			Body:          ioutil.NopCloser(strings.NewReader("not replayable")),
+			Request:       req,
+		}, nil
+	})
+
+	for _, verify := range []bool{false, true} {
+		handler := httpcache.NewCacheHandlerRoundtrip(transport, true, newInmemCache())
+		handler.VerifyOnStore = verify
+		client := &http.Client{Transport: handler}
+
+		req, err := http.NewRequest(http.MethodGet, "http://bxcodec.io", nil)
+		require.NoError(t, err)
+		_, body := doRequest(t, client, req)
+		require.Equal(t, "not replayable", body)
+
+		entries := listDebugEntries(t, httpcache.DebugHandler(handler))
+		if verify {
+			require.Empty(t, entries)
+		} else {
+			require.Len(t, entries, 1)
+		}
+	}
+}
+
+func TestHitPolicyFunc(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	action := httpcache.HitActionServe
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.HitPolicyFunc = func(req *http.Request, entry cache.CachedResponse) httpcache.HitAction {
+		return action
+	}
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	resp, body := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "1", body)
+
+	// the entry is still fresh, but it's refetched and replaced
+	action = httpcache.HitActionRevalidate
+	resp, body = doRequest(t, client, req)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "2", body)
+
+	// the origin is fetched, but the stored entry is kept
+	action = httpcache.HitActionBypass
+	_, body = doRequest(t, client, req)
+	require.Equal(t, "3", body)
+
+	action = httpcache.HitActionServe
+	resp, body = doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "2", body)
+	require.EqualValues(t, 3, *hits)
+}
+
+func TestTTLBySize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, err := w.Write([]byte(strings.Repeat("x", size)))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+
+	storedTTL := func(size int, maxTTL time.Duration) time.Duration {
+		handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+		handler.MaxTTL = maxTTL
+		handler.TTLBySize = func(bytes int64, computed time.Duration) time.Duration {
+			if bytes > 1024 {
+				return computed * 2
+			}
+			return computed / 2
+		}
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s?size=%d", server.URL, size), nil)
+		require.NoError(t, err)
+		doRequest(t, &http.Client{Transport: handler}, req)
+
+		entries := listDebugEntries(t, httpcache.DebugHandler(handler))
+		require.Len(t, entries, 1)
+		return entries[0].ExpiresAt.Sub(entries[0].CachedTime)
+	}
+
+	require.InDelta(t, float64(time.Second*30), float64(storedTTL(10, 0)), float64(time.Second))
+	require.InDelta(t, float64(time.Second*120), float64(storedTTL(1024*1024, 0)), float64(time.Second))
+	require.InDelta(t, float64(time.Second*90), float64(storedTTL(1024*1024, time.Second*90)), float64(time.Second))
+}
+
+func TestMaxAgeZeroIsStored(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=0, must-revalidate")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	// stored, but already stale
+	entries := listDebugEntries(t, httpcache.DebugHandler(handler))
+	require.Len(t, entries, 1)
+	require.True(t, entries[0].ExpiresAt.Equal(entries[0].CachedTime))
+
+	resp, body := doRequest(t, client, req)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "2", body)
+	require.EqualValues(t, 2, *hits)
+}
+
+func TestMaxHeaderBytes(t *testing.T) {
+	huge := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		if huge {
+			w.Header().Set("Set-Cookie", "session="+strings.Repeat("x", 4096))
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.MaxHeaderBytes = 1024
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	huge = true
+	doRequest(t, client, req)
+	require.Empty(t, listDebugEntries(t, httpcache.DebugHandler(handler)))
+
+	huge = false
+	doRequest(t, client, req)
+	require.Len(t, listDebugEntries(t, httpcache.DebugHandler(handler)), 1)
+}
+
+func TestSetCookieNotStored(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	for _, allowed := range []bool{false, true} {
+		handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+		handler.AllowSetCookieCaching = allowed
+		client := &http.Client{Transport: handler}
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+
+		doRequest(t, client, req)
+		resp, _ := doRequest(t, client, req)
+		require.Equal(t, allowed, httpcache.FromCache(resp))
+		entries := listDebugEntries(t, httpcache.DebugHandler(handler))
+		if !allowed {
+			require.Empty(t, entries)
+			continue
+		}
+		require.Len(t, entries, 1)
+		require.Equal(t, "session=secret", resp.Header.Get("Set-Cookie"))
+	}
+}
+
+func TestSetCookieNotStreamed(t *testing.T) {
+	release := make(chan struct{})
+	server, hits, arrived := newStreamingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Set-Cookie", "session="+r.Header.Get("X-User"))
+	}, release)
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.StreamCoalescing = true
+	client := &http.Client{Transport: handler}
+
+	newRequest := func(user string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		req.Header.Set("X-User", user)
+		return req
+	}
+
+	// the concurrent request doesn't follow the response with the cookie of another user, it fetches its own
+	first, err := client.Do(newRequest("first"))
+	require.NoError(t, err)
+	defer first.Body.Close()
+	<-arrived
+	second, err := client.Do(newRequest("second"))
+	require.NoError(t, err)
+	defer second.Body.Close()
+	require.EqualValues(t, 2, atomic.LoadInt64(hits))
+	require.Equal(t, "session=second", second.Header.Get("Set-Cookie"))
+	close(release)
+	_, err = ioutil.ReadAll(first.Body)
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(second.Body)
+	require.NoError(t, err)
+	require.Empty(t, listDebugEntries(t, httpcache.DebugHandler(handler)))
+}
+
+func TestRequestNoStoreNotStored(t *testing.T) {
+	server, _ := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	for _, complyRFC := range []bool{true, false} {
+		handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, complyRFC, newInmemCache())
+		client := &http.Client{Transport: handler}
+
+		// even without the RFC checks of the response
+		noStore, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		noStore.Header.Set("Cache-Control", "no-store")
+		doRequest(t, client, noStore)
+		require.Empty(t, listDebugEntries(t, httpcache.DebugHandler(handler)))
+
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		doRequest(t, client, req)
+		require.Len(t, listDebugEntries(t, httpcache.DebugHandler(handler)), 1)
+	}
+}
@@ -0,0 +1,55 @@
+package httpcache
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Purge will delete the entry of the request, its next call is fetched from the origin. The request is keyed
+// the same way as in RoundTrip, e.g. with its Authorization header or its tenant, and all its Vary variants are purged.
+func (r *CacheHandler) Purge(req *http.Request) error {
+	if !hasAbsoluteURL(req) || (r.TenantFunc != nil && r.TenantFunc(req.Context()) == "") {
+		return ErrNotPurgeable
+	}
+	return storageError(r.CacheInteractor.Delete(r.cacheKey(req)))
+}
+
+// PurgeAll will delete all the entries of the cache storage
+func (r *CacheHandler) PurgeAll() error {
+	return storageError(r.CacheInteractor.Flush())
+}
+
+// purgeFromResponse will invalidate the entries listed in the PurgeHeader of the origin response.
+// Each comma-separated value is an URL, relative to the request URL, whose GET entry is deleted.
+// Only the entry keyed without any request header is purged, e.g. not the one keyed with an Authorization.
+// The URLs of another scheme or host are skipped, an origin can't purge the entries of another one.
+func (r *CacheHandler) purgeFromResponse(req *http.Request, resp *http.Response) {
+	if r.PurgeHeader == "" {
+		return
+	}
+	for _, value := range resp.Header[http.CanonicalHeaderKey(r.PurgeHeader)] {
+		for _, ref := range strings.Split(value, ",") {
+			ref = strings.TrimSpace(ref)
+			if ref == "" {
+				continue
+			}
+			target, err := req.URL.Parse(ref)
+			if err != nil {
+				r.logger().Printf("Can't parse the URL to purge, plase check. Err: %v\n", err)
+				continue
+			}
+			if target.Scheme != req.URL.Scheme || target.Host != req.URL.Host {
+				r.logger().Printf("Can't purge the URL %v of another origin than %v\n", target, req.URL.Host)
+				continue
+			}
+			purgeReq, err := http.NewRequestWithContext(req.Context(), http.MethodGet, target.String(), nil)
+			if err != nil {
+				r.logger().Printf("Can't build the request to purge, plase check. Err: %v\n", err)
+				continue
+			}
+			if err = r.CacheInteractor.Delete(r.cacheKey(purgeReq)); err != nil {
+				r.logger().Printf("Can't purge the item from the database, plase check. Err: %v\n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package httpcache_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeHeader(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.Header().Set("X-Purge", "/products/123, /products/456")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		hits++
+		w.Header().Set("Cache-Control", "max-age=3600")
+		fmt.Fprintf(w, "%d", hits)
+	}))
+	defer server.Close()
+
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.PurgeHeader = "X-Purge"
+	client := &http.Client{Transport: handler}
+
+	product, err := http.NewRequest(http.MethodGet, server.URL+"/products/123", nil)
+	require.NoError(t, err)
+	doRequest(t, client, product)
+	_, body := doRequest(t, client, product)
+	require.Equal(t, "1", body)
+
+	update, err := http.NewRequest(http.MethodPost, server.URL+"/products/123", nil)
+	require.NoError(t, err)
+	doRequest(t, client, update)
+
+	resp, body := doRequest(t, client, product)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "2", body)
+}
+
+func TestPurgeHeaderOtherOrigin(t *testing.T) {
+	hits := 0
+	victim := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Cache-Control", "max-age=3600")
+		fmt.Fprintf(w, "%d", hits)
+	}))
+	defer victim.Close()
+	attacker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Purge", victim.URL+"/products/123")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer attacker.Close()
+
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.PurgeHeader = "X-Purge"
+	client := &http.Client{Transport: handler}
+
+	product, err := http.NewRequest(http.MethodGet, victim.URL+"/products/123", nil)
+	require.NoError(t, err)
+	doRequest(t, client, product)
+
+	// the entry of another origin is kept
+	update, err := http.NewRequest(http.MethodPost, attacker.URL+"/products/123", nil)
+	require.NoError(t, err)
+	doRequest(t, client, update)
+	resp, body := doRequest(t, client, product)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "1", body)
+}
+
+func TestPurge(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	first, err := http.NewRequest(http.MethodGet, server.URL+"/first", nil)
+	require.NoError(t, err)
+	second, err := http.NewRequest(http.MethodGet, server.URL+"/second", nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, first)
+	doRequest(t, client, second)
+	require.NoError(t, handler.Purge(first))
+
+	// only the purged URL is fetched again
+	resp, body := doRequest(t, client, first)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "3", body)
+	resp, body = doRequest(t, client, second)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "2", body)
+	require.Equal(t, int64(3), *hits)
+
+	// purging a missing entry is not an error
+	require.NoError(t, handler.Purge(first))
+	require.NoError(t, handler.Purge(first))
+
+	relative, err := http.NewRequest(http.MethodGet, "/first", nil)
+	require.NoError(t, err)
+	require.True(t, errors.Is(handler.Purge(relative), httpcache.ErrNotPurgeable))
+}
+
+func TestPurgeAll(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	first, err := http.NewRequest(http.MethodGet, server.URL+"/first", nil)
+	require.NoError(t, err)
+	second, err := http.NewRequest(http.MethodGet, server.URL+"/second", nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, first)
+	doRequest(t, client, second)
+	require.NoError(t, handler.PurgeAll())
+
+	resp, _ := doRequest(t, client, first)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	resp, _ = doRequest(t, client, second)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, int64(4), *hits)
+}
@@ -0,0 +1,68 @@
+package httpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRangeNotStored(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Cache-Control", "max-age=3600")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader("hello world"))
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.StreamCoalescing = true
+	client := &http.Client{Transport: handler}
+
+	ranged, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	ranged.Header.Set("Range", "bytes=0-4")
+	resp, body := doRequest(t, client, ranged)
+	require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	require.Equal(t, "hello", body)
+	require.Empty(t, listDebugEntries(t, httpcache.DebugHandler(handler)))
+
+	// the whole resource is fetched, and stored
+	full, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	resp, body = doRequest(t, client, full)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.False(t, httpcache.FromCache(resp))
+	require.Equal(t, "hello world", body)
+	resp, body = doRequest(t, client, full)
+	require.True(t, httpcache.FromCache(resp))
+	require.Equal(t, "hello world", body)
+	require.Equal(t, 2, hits)
+}
+
+func TestPartialContentNotStored(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		// a 206 even without Range, e.g. a misbehaving origin
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Content-Range", "bytes 0-4/11")
+		w.WriteHeader(http.StatusPartialContent)
+		_, err := w.Write([]byte("hello"))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	resp, _ := doRequest(t, client, req)
+	require.False(t, httpcache.FromCache(resp))
+	require.Equal(t, 2, hits)
+}
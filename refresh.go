@@ -0,0 +1,29 @@
+package httpcache
+
+import (
+	"time"
+
+	"github.com/bxcodec/httpcache/cache"
+)
+
+// inRefreshAhead will check if the fresh entry expires within RefreshAhead, it's then refreshed in the background
+// while it's still served
+func (r *CacheHandler) inRefreshAhead(item cache.CachedResponse) bool {
+	if r.RefreshAhead <= 0 {
+		return false
+	}
+	expiresAt := r.storedExpiration(item)
+	return !expiresAt.IsZero() && expiresAt.Sub(r.now()) < r.refreshWindow(item)
+}
+
+// refreshWindow will return the RefreshAhead of the entry, narrowed by its share of RefreshAheadJitter
+func (r *CacheHandler) refreshWindow(item cache.CachedResponse) time.Duration {
+	jitter := r.RefreshAheadJitter
+	if jitter <= 0 {
+		return r.RefreshAhead
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	return r.RefreshAhead - time.Duration(float64(r.RefreshAhead)*jitter*item.RefreshJitter)
+}
@@ -0,0 +1,161 @@
+package httpcache_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshAhead(t *testing.T) {
+	var hits int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit := atomic.AddInt64(&hits, 1)
+		// without Date, the freshness only counts on the fake clock
+		w.Header()["Date"] = nil
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, err := fmt.Fprintf(w, "%d", hit)
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	clock := &fakeClock{now: time.Now()}
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.Clock = clock.Now
+	handler.RefreshAhead = 10 * time.Second
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, client, req)
+
+	// outside the window, it's only served
+	clock.Advance(45 * time.Second)
+	resp, body := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "1", body)
+	time.Sleep(50 * time.Millisecond)
+	require.EqualValues(t, 1, atomic.LoadInt64(&hits))
+
+	// within the window, the fresh entry is served and refreshed in the background
+	clock.Advance(10 * time.Second)
+	resp, body = doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "1", body)
+	require.Eventually(t, func() bool {
+		resp, body := doRequest(t, client, req)
+		return resp.Header.Get(httpcache.XFromHache) == "true" && body == "2"
+	}, time.Second, 10*time.Millisecond)
+
+	// the refreshed entry is outside the window again
+	time.Sleep(50 * time.Millisecond)
+	require.EqualValues(t, 2, atomic.LoadInt64(&hits))
+}
+
+func TestRefreshAheadOnce(t *testing.T) {
+	var hits int64
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&hits, 1) > 1 {
+			<-release
+		}
+		w.Header()["Date"] = nil
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, err := w.Write([]byte("hello"))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	clock := &fakeClock{now: time.Now()}
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.Clock = clock.Now
+	handler.RefreshAhead = 10 * time.Second
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, client, req)
+
+	clock.Advance(55 * time.Second)
+	doRequest(t, client, req)
+	require.Eventually(t, func() bool { return atomic.LoadInt64(&hits) == 2 }, time.Second, 10*time.Millisecond)
+
+	// the hits during the refresh don't start another one, nor a goroutine waiting for it
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		resp, _ := doRequest(t, client, req)
+		require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	}
+	require.True(t, runtime.NumGoroutine() < goroutines+10, "%d goroutines, %d before", runtime.NumGoroutine(), goroutines)
+	time.Sleep(50 * time.Millisecond)
+	require.EqualValues(t, 2, atomic.LoadInt64(&hits))
+	close(release)
+}
+
+func TestRefreshAheadJitter(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		w.Header()["Date"] = nil
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, err := w.Write([]byte("hello"))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	hitsOf := func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits[path]
+	}
+	clock := &fakeClock{now: time.Now()}
+	rands := []float64{0, 0.5, 0.9}
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.Clock = clock.Now
+	handler.RefreshAhead = 20 * time.Second
+	handler.RefreshAheadJitter = 1
+	handler.Rand = func() float64 {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(rands) == 0 {
+			// the refreshed entries
+			return 0.5
+		}
+		n := rands[0]
+		rands = rands[1:]
+		return n
+	}
+	client := &http.Client{Transport: handler}
+	// the entries with the same freshness get the windows of 20s, 10s and 2s
+	paths := []string{"/a", "/b", "/c"}
+	for _, path := range paths {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		doRequest(t, client, req)
+	}
+
+	for i, elapsed := range []time.Duration{45 * time.Second, 7 * time.Second, 7 * time.Second} {
+		clock.Advance(elapsed)
+		for _, path := range paths {
+			req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+			require.NoError(t, err)
+			resp, _ := doRequest(t, client, req)
+			require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+		}
+		// only the entry entering its window is refreshed
+		require.Eventually(t, func() bool { return hitsOf(paths[i]) == 2 }, time.Second, 10*time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		for j, path := range paths {
+			want := 1
+			if j <= i {
+				want = 2
+			}
+			require.Equal(t, want, hitsOf(path), "%s after %d steps", path, i+1)
+		}
+	}
+}
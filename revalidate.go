@@ -0,0 +1,231 @@
+package httpcache
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bxcodec/httpcache/cache"
+	cacheControl "github.com/bxcodec/httpcache/helper/cacheheader"
+)
+
+// conditionalHeaders are the request headers making a request conditional
+var conditionalHeaders = []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range"}
+
+// staleEntry is a stored response to revalidate with a conditional request
+type staleEntry struct {
+	resp *http.Response
+	item cache.CachedResponse
+}
+
+// isConditional will check if the request already has its own validators, those are passed to the origin
+// as they are, since a 304 to an unconditional request can't be served from the client ones.
+func isConditional(req *http.Request) bool {
+	for _, name := range conditionalHeaders {
+		if req.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// unconditional will return a copy of the request without any conditional header
+func unconditional(req *http.Request) *http.Request {
+	retry := req.Clone(req.Context())
+	for _, name := range conditionalHeaders {
+		retry.Header.Del(name)
+	}
+	return retry
+}
+
+// isStored will check if a response of the request is stored, even an expired one
+func (r *CacheHandler) isStored(key string, req *http.Request) bool {
+	cachedResp, _, _ := r.getCachedResponse(key, req)
+	if cachedResp == nil {
+		return false
+	}
+	cachedResp.Body.Close()
+	return true
+}
+
+// revalidatable will return the stored response as a stale entry, when it can be revalidated for the request
+func revalidatable(req *http.Request, resp *http.Response, item cache.CachedResponse) *staleEntry {
+	if !hasValidator(resp.Header) || isConditional(req) {
+		return nil
+	}
+	return &staleEntry{resp: resp, item: item}
+}
+
+// fetch will send the request to the origin, conditionally when there is a stale entry to revalidate.
+// A revalidated response is the renewed stored one, it must not be stored again.
+func (r *CacheHandler) fetch(key string, req *http.Request, stale *staleEntry,
+	timing *serverTiming) (resp *http.Response, revalidated bool, err error) {
+	if stale == nil {
+		resp, err = r.fetchOrigin(req, timing)
+		if err == nil && resp.StatusCode == http.StatusNotModified && !r.isStored(key, req) {
+			// e.g. the validators of an entry flushed since, the bodyless 304 can't be served from the cache
+			resp.Body.Close()
+			r.logger().Printf("The origin replied 304 to %v without a stored response, fetching it again\n", req.URL)
+			resp, err = r.fetchOrigin(unconditional(req), timing)
+		}
+		return
+	}
+	return r.revalidate(key, req, stale, timing)
+}
+
+// revalidate will send the request with the validator (ETag or Last-Modified) of the stale entry. On a 304,
+// the stored response is updated with the headers of the 304, renewed and returned, otherwise the origin
+// response is returned.
+func (r *CacheHandler) revalidate(key string, req *http.Request, stale *staleEntry,
+	timing *serverTiming) (resp *http.Response, revalidated bool, err error) {
+	condReq := req.Clone(req.Context())
+	var variants map[string]*staleEntry
+	// the ETag is the stronger validator, Last-Modified only has a second precision
+	if etag := stale.resp.Header.Get("ETag"); etag != "" {
+		variants = r.otherVariants(key, req, stale)
+		etags := []string{etag}
+		for other := range variants {
+			etags = append(etags, other)
+		}
+		sort.Strings(etags[1:])
+		condReq.Header.Set("If-None-Match", strings.Join(etags, ", "))
+	} else {
+		condReq.Header.Set("If-Modified-Since", stale.resp.Header.Get("Last-Modified"))
+	}
+
+	start := time.Now()
+	resp, err = r.revalidationRoundTripper().RoundTrip(condReq)
+	timing.measure("revalidation", start)
+	matched, ok := variants[resp304ETag(resp)]
+	for _, other := range variants {
+		if other != matched {
+			other.resp.Body.Close()
+		}
+	}
+	if err != nil {
+		stale.resp.Body.Close()
+		return
+	}
+	if resp.StatusCode != http.StatusNotModified {
+		// the origin sent a new response, stored as a refetched one
+		stale.resp.Body.Close()
+		if ok {
+			matched.resp.Body.Close()
+		}
+		resp.Request = req
+		return
+	}
+	resp.Body.Close()
+	var matchedValues map[string][]string
+	if ok {
+		// the 304 validates another variant, it's the response of the request now
+		stale.resp.Body.Close()
+		matched.resp.Request = req
+		matchedValues, matched.item.VaryHeaders = matched.item.VaryHeaders, stale.item.VaryHeaders
+		stale = matched
+	}
+
+	for name, values := range resp.Header {
+		// the Content-Length of a 304 doesn't describe the stored body
+		if name != "Content-Length" && !isHopByHop(name, resp.Header) {
+			stale.resp.Header[name] = values
+		}
+	}
+	renewed := stale.item
+	renewed.CachedTime = r.now()
+	renewed.ExpiresAt = time.Time{}
+	switch {
+	case hasExplicitFreshness(resp.Header):
+		// the new lifetime of the 304 restarts from its Date
+		renewed.ExpiresAt = renewed.CachedTime
+		if ttl := r.headerFreshness(req, stale.resp) - dateAge(resp.Header, renewed.CachedTime); ttl > 0 {
+			renewed.ExpiresAt = renewed.CachedTime.Add(r.clampTTL(req, stale.resp, ttl))
+		}
+	case !stale.item.ExpiresAt.IsZero():
+		// an explicit lifetime (e.g. DefaultTTL or WithTTL) is kept
+		ttl := r.clampTTL(req, stale.resp, stale.item.ExpiresAt.Sub(stale.item.CachedTime))
+		renewed.ExpiresAt = renewed.CachedTime.Add(ttl)
+	default:
+		if ttl := r.clampTTL(req, stale.resp, 0); ttl > 0 {
+			renewed.ExpiresAt = renewed.CachedTime.Add(ttl)
+		}
+	}
+	if renewed.DumpedResponse, err = r.dumpResponse(stale.resp); err != nil {
+		return nil, false, err
+	}
+	if errStore := r.setEntry(key, req, renewed); errStore != nil {
+		r.observer().OnError(key, errStore)
+		r.logger().Printf("Can't renew the revalidated response in the database, plase check. Err: %v\n", errStore)
+	} else {
+		r.observer().OnStore(key)
+	}
+	if matchedValues != nil {
+		// the validated variant is renewed too
+		renewedVariant := renewed
+		renewedVariant.VaryHeaders = matchedValues
+		if errStore := r.setEntry(key, variantRequest(req, matchedValues), renewedVariant); errStore != nil {
+			r.observer().OnError(key, errStore)
+			r.logger().Printf("Can't renew the revalidated response in the database, plase check. Err: %v\n", errStore)
+		}
+	}
+	r.buildTheCachedResponseHeader(stale.resp, renewed, renewed.CachedTime)
+	return stale.resp, true, nil
+}
+
+// otherVariants will return the other stored variants of the key with an ETag, by ETag, so a single
+// revalidation sends all of them and the 304 selects the one still current for the request
+func (r *CacheHandler) otherVariants(key string, req *http.Request, stale *staleEntry) map[string]*staleEntry {
+	index, err := r.CacheInteractor.Get(key)
+	if err != nil || !isVaryIndex(index) || len(index.Variants) < 2 {
+		return nil
+	}
+	etag := stale.resp.Header.Get("ETag")
+	variants := make(map[string]*staleEntry)
+	for _, values := range index.Variants {
+		variantReq := variantRequest(req, values)
+		if r.matchVary(stale.item, variantReq) {
+			continue
+		}
+		resp, item, err := r.getCachedResponse(key, variantReq)
+		if resp == nil {
+			continue
+		}
+		other := resp.Header.Get("ETag")
+		if (err != nil && !errors.Is(err, ErrExpired)) || other == "" || other == etag || variants[other] != nil {
+			resp.Body.Close()
+			continue
+		}
+		variants[other] = &staleEntry{resp: resp, item: item}
+	}
+	return variants
+}
+
+// resp304ETag will return the ETag of a 304, the validator of the stored response it selects
+func resp304ETag(resp *http.Response) string {
+	if resp == nil || resp.StatusCode != http.StatusNotModified {
+		return ""
+	}
+	return resp.Header.Get("ETag")
+}
+
+// hasExplicitFreshness will check if the response header gives its freshness lifetime,
+// with a max-age, a s-maxage or an Expires header
+func hasExplicitFreshness(header http.Header) bool {
+	if header.Get("Expires") != "" {
+		return true
+	}
+	dir, err := cacheControl.ParseResponseCacheControl(header.Get(HeaderCacheControl))
+	return err == nil && (dir.MaxAge != -1 || dir.SMaxAge != -1)
+}
+
+// dateAge will return how long ago the response was generated according to its Date header, zero without it.
+// It's in whole seconds, the precision of the Date header.
+func dateAge(header http.Header, now time.Time) time.Duration {
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil || date.After(now) {
+		return 0
+	}
+	return now.Sub(date).Truncate(time.Second)
+}
@@ -0,0 +1,379 @@
+package httpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+// newETagServer will start a server that replies with the current body and ETag, or a 304 when the
+// If-None-Match matches the ETag
+func newETagServer(t *testing.T, body, etag *string) (server *httptest.Server, gets, notModified *int) {
+	gets, notModified = new(int), new(int)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=1")
+		w.Header().Set("ETag", *etag)
+		if r.Header.Get("If-None-Match") == *etag {
+			*notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		*gets++
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(*body))
+		require.NoError(t, err)
+	}))
+	return
+}
+
+func TestETagRevalidation(t *testing.T) {
+	body, etag := "hello", `"v1"`
+	server, gets, notModified := newETagServer(t, &body, &etag)
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	resp, _ := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	time.Sleep(time.Millisecond * 1100)
+
+	// not modified, the stored body is served
+	resp, got := doRequest(t, client, req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "hello", got)
+	require.Equal(t, 1, *gets)
+	require.Equal(t, 1, *notModified)
+
+	// and renewed
+	resp, _ = doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, 1, *notModified)
+
+	// modified, the entry is replaced
+	body, etag = "hello world", `"v2"`
+	time.Sleep(time.Millisecond * 1100)
+	resp, got = doRequest(t, client, req)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "hello world", got)
+	require.Equal(t, 2, *gets)
+
+	resp, got = doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "hello world", got)
+	require.Equal(t, 2, *gets)
+}
+
+func TestETagRevalidationNotForConditionalRequests(t *testing.T) {
+	body, etag := "hello", `"v1"`
+	server, gets, notModified := newETagServer(t, &body, &etag)
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	time.Sleep(time.Millisecond * 1100)
+
+	// the 304 answers the validator of the client, it's passed through
+	req.Header.Set("If-None-Match", `"v1"`)
+	resp, _ := doRequest(t, client, req)
+	require.Equal(t, http.StatusNotModified, resp.StatusCode)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, 1, *gets)
+	require.Equal(t, 1, *notModified)
+
+	// and it's not stored
+	req.Header.Del("If-None-Match")
+	resp, got := doRequest(t, client, req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "hello", got)
+}
+
+func TestLastModifiedRevalidation(t *testing.T) {
+	body, lastModified := "hello", time.Now().Add(-time.Hour).UTC()
+	gets, notModified := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=1")
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err == nil && !lastModified.Truncate(time.Second).After(since) {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		gets++
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write([]byte(body))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	time.Sleep(time.Millisecond * 1100)
+
+	// not modified, the stored body is served and renewed
+	resp, got := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "hello", got)
+	require.Equal(t, 1, gets)
+	require.Equal(t, 1, notModified)
+	resp, _ = doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, 1, notModified)
+
+	// modified, the entry is replaced
+	body, lastModified = "hello world", time.Now().UTC()
+	time.Sleep(time.Millisecond * 1100)
+	resp, got = doRequest(t, client, req)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "hello world", got)
+	require.Equal(t, 2, gets)
+
+	resp, got = doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "hello world", got)
+}
+
+func TestETagRevalidationPrecedence(t *testing.T) {
+	var conditions []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditions = append(conditions, r.Header.Clone())
+		w.Header().Set("Cache-Control", "max-age=1")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte("hello"))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	time.Sleep(time.Millisecond * 1100)
+	resp, got := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "hello", got)
+
+	require.Len(t, conditions, 2)
+	require.Equal(t, `"v1"`, conditions[1].Get("If-None-Match"))
+	require.Empty(t, conditions[1].Get("If-Modified-Since"))
+}
+
+func TestRevalidationFreshnessFrom304(t *testing.T) {
+	gets, notModified := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			// a longer lifetime than the stored response
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		gets++
+		w.Header().Set("Cache-Control", "max-age=1")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte("hello"))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	time.Sleep(time.Millisecond * 1100)
+	resp, _ := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, 1, notModified)
+
+	// fresh past the original expiry, with the max-age of the 304
+	time.Sleep(time.Millisecond * 1100)
+	resp, got := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "hello", got)
+	require.Equal(t, 1, notModified)
+	require.Equal(t, 1, gets)
+
+	entries := listDebugEntries(t, httpcache.DebugHandler(handler))
+	require.Len(t, entries, 1)
+	require.InDelta(t, time.Minute.Seconds(), entries[0].ExpiresAt.Sub(entries[0].CachedTime).Seconds(), 1)
+}
+
+func TestImmutableNotRevalidatedWhileFresh(t *testing.T) {
+	var conditional int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60, immutable")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") != "" {
+			conditional++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte("hello"))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	clock := &fakeClock{now: time.Now()}
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.Clock = clock.Now
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, client, req)
+
+	// not even for a reload of the client during its freshness
+	req.Header.Set("Cache-Control", "max-age=0")
+	for i := 0; i < 3; i++ {
+		clock.Advance(10 * time.Second)
+		resp, got := doRequest(t, client, req)
+		require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+		require.Equal(t, "hello", got)
+	}
+	require.Zero(t, conditional)
+
+	// revalidated once stale
+	req.Header.Del("Cache-Control")
+	clock.Advance(time.Minute)
+	resp, _ := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, 1, conditional)
+}
+
+func TestETagRevalidationVariants(t *testing.T) {
+	var mu sync.Mutex
+	etags := map[string]string{"a": `"a1"`, "b": `"b1"`}
+	var gets, notModified int
+	var ifNoneMatch string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		etag := etags[r.Header.Get("X-Variant")]
+		w.Header()["Date"] = nil
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "X-Variant")
+		w.Header().Set("ETag", etag)
+		if inm := r.Header.Get("If-None-Match"); inm != "" {
+			ifNoneMatch = inm
+			for _, candidate := range strings.Split(inm, ",") {
+				if strings.TrimSpace(candidate) == etag {
+					notModified++
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+			}
+		}
+		gets++
+		_, err := w.Write([]byte(strings.Trim(etag, `"`)))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	clock := &fakeClock{now: time.Now()}
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.Clock = clock.Now
+	client := &http.Client{Transport: handler}
+	variantReq := func(variant string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Variant", variant)
+		return req
+	}
+	doRequest(t, client, variantReq("a"))
+	doRequest(t, client, variantReq("b"))
+	require.Equal(t, 2, gets)
+
+	// the b variant is now the representation of a, validated by the ETag of the stored a
+	mu.Lock()
+	etags["b"] = `"a1"`
+	mu.Unlock()
+	clock.Advance(2 * time.Minute)
+	resp, got := doRequest(t, client, variantReq("b"))
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "a1", got)
+	require.Equal(t, `"a1"`, resp.Header.Get("ETag"))
+	require.Equal(t, `"b1", "a1"`, ifNoneMatch)
+	require.Equal(t, 2, gets)
+	require.Equal(t, 1, notModified)
+
+	// both variants are renewed
+	for _, variant := range []string{"a", "b"} {
+		resp, got := doRequest(t, client, variantReq(variant))
+		require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+		require.Equal(t, "a1", got)
+	}
+	require.Equal(t, 1, notModified)
+
+	// a 304 with the own ETag of the variant renews it as it is
+	clock.Advance(2 * time.Minute)
+	mu.Lock()
+	etags["a"], etags["b"] = `"a2"`, `"a1"`
+	mu.Unlock()
+	resp, got = doRequest(t, client, variantReq("b"))
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "a1", got)
+	require.Equal(t, 2, notModified)
+	require.Equal(t, 2, gets)
+}
+
+func TestNotModifiedWithoutStoredEntry(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+		if hits == 1 || r.Header.Get("If-None-Match") == `"v1"` {
+			// the first one as if it validated an entry flushed since
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, err := w.Write([]byte("hello"))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	// fetched again unconditionally, then stored
+	resp, got := doRequest(t, client, req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "hello", got)
+	require.Equal(t, 2, hits)
+	resp, got = doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "hello", got)
+
+	// the validators of the client are stripped from the retry, e.g. those of an entry flushed since
+	condReq, err := http.NewRequest(http.MethodGet, server.URL+"/conditional", nil)
+	require.NoError(t, err)
+	condReq.Header.Set("If-None-Match", `"v1"`)
+	resp, got = doRequest(t, client, condReq)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "hello", got)
+	require.Equal(t, 4, hits)
+}
@@ -3,46 +3,247 @@ package httpcache
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"net/http/httputil"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/bxcodec/httpcache/cache"
 	cacheControl "github.com/bxcodec/httpcache/helper/cacheheader"
+	"golang.org/x/sync/singleflight"
 )
 
 // Headers
 const (
 	HeaderAuthorization = "Authorization"
 	HeaderCacheControl  = "Cache-Control"
+	HeaderAge           = "Age"
 	// To indicate that the response is got from this httpcache library
 	XFromHache   = "X-HTTPCache"
 	XHacheOrigin = "X-HTTPCache-Origin"
+	// XHacheName is the Name of the handler serving a cached response
+	XHacheName = "X-HTTPCache-Name"
+	// XFromHacheValue is the value of the XFromHache header of a response served from the cache,
+	// the live responses don't have the header. See FromCache.
+	XFromHacheValue = "true"
 )
 
 // CacheHandler custom plugable' struct of implementation of the http.RoundTripper
 type CacheHandler struct {
+	// DefaultRoundTripper is used to fetch the origin. The cache sits above it, so when it retries internally
+	// (e.g. a retrying transport) it's still one logical request: a single lookup, a single store of the final
+	// response, and the key (also used for the stream coalescing) comes from the original request.
 	DefaultRoundTripper http.RoundTripper
-	CacheInteractor     cache.ICacheInteractor
-	ComplyRFC           bool
+	// RevalidationRoundTripper is used for the requests revalidating a stored response (e.g. the HEAD probes
+	// of HeadRevalidation), instead of the DefaultRoundTripper, e.g. to send them to a validation service.
+	RevalidationRoundTripper http.RoundTripper
+	CacheInteractor          cache.ICacheInteractor
+	ComplyRFC                bool
+	// Name identifies the handler in the XHacheName header of the cached responses, e.g. to tell the caches
+	// of a client apart while debugging. The header is omitted when empty.
+	Name string
+	// HeaderNames override the names of the headers added to the cached responses, see HeaderNames
+	HeaderNames HeaderNames
+	// Shared is the RFC 7234 mode of a shared cache (e.g. a proxy in front of many users), the `private`
+	// responses are not stored and s-maxage overrides max-age. Otherwise the cache is private to a single user
+	// (e.g. a client), the `private` responses are stored and s-maxage is ignored. Enabled by New.
+	Shared bool
+	// Logger receives the failures the handler recovers from (e.g. a storage error, served from the origin),
+	// pass log.New(os.Stderr, "", log.LstdFlags) to see them. They are discarded when nil.
+	Logger Logger
+	// Observer is notified of the hits, misses, stores and storage errors, nothing is notified when nil.
+	Observer Observer
+	// Clock returns the current time of the freshness computations (storage, expiration, Age), e.g. a fake clock
+	// to test the expiration deterministically. time.Now is used when nil.
+	Clock func() time.Time
+	// KeyFunc replaces the built-in cache key, HostAliases and the authorization keying are then unused.
+	// See KeyFunc for the details.
+	KeyFunc KeyFunc
+	// KeyHashFunc is used to hash the cache key before it's passed to the storage. When nil, it's SHA256KeyHash,
+	// so the storage keys have a bounded length whatever the URL. RawKey keeps the readable key (the method and
+	// URL) instead. See KeyHashFunc for the collision tradeoffs.
+	KeyHashFunc KeyHashFunc
+	// BodyPolicyFunc is consulted before storing a response to decide its cacheability from the body.
+	// See BodyPolicyFunc for the details.
+	BodyPolicyFunc BodyPolicyFunc
+	// VaryNormalizer canonicalizes the values of the request headers listed by the Vary header of the responses,
+	// before they select a variant. See VaryNormalizerFunc for the details.
+	VaryNormalizer VaryNormalizerFunc
+	// ContentLanguageKeying will select the variants of the responses with `Vary: Accept-Language` by their
+	// Content-Language (the language actually served) instead of the raw Accept-Language, so the requests served
+	// the same language share one entry. A miss learns which language the Accept-Language of the request is
+	// served, the responses without Content-Language are keyed by the raw header.
+	ContentLanguageKeying bool
+	// DefaultTTL is the freshness given to the responses without any caching header
+	// (Cache-Control, Expires, Last-Modified or ETag). When zero, those responses are not cached.
+	DefaultTTL time.Duration
+	// MaxTTL caps the lifetime of every stored response, whatever its freshness. Disabled when zero.
+	MaxTTL time.Duration
+	// TTLJitter is the fraction (e.g. 0.1) by which each stored lifetime is randomly reduced, so the entries stored
+	// together (e.g. after a deploy) don't expire together and stampede the origin. Disabled when zero.
+	TTLJitter float64
+	// Rand returns the random numbers in [0, 1) of TTLJitter, e.g. a seeded source for the tests.
+	// rand.Float64 is used when nil.
+	Rand func() float64
+	// MaxHeaderBytes is the maximum size of the serialized headers of a stored response, the responses with
+	// larger headers (e.g. a huge Set-Cookie) are not stored. Disabled when zero.
+	MaxHeaderBytes int
+	// AllowSetCookieCaching will store the responses with a Set-Cookie header, only for a single user cache:
+	// the cookie (e.g. a session) is replayed to every request served from the entry. Disabled by default.
+	AllowSetCookieCaching bool
+	// CacheableStatusCodes are the only status codes stored when set, e.g. {200: true, 301: true, 308: true},
+	// the responses must still be cacheable from their headers. When nil, any status code can be stored.
+	CacheableStatusCodes map[int]bool
+	// NegativeCache are the lifetimes of the error responses stored by status code, e.g. {404: 30 * time.Second},
+	// to spare the origin the repeated requests of a missing resource. They are stored with that lifetime even
+	// without cacheability headers or when CacheableStatusCodes doesn't list them, unless they have a no-store.
+	NegativeCache map[int]time.Duration
+	// CacheableMethods are the request methods read from and stored to the cache, the requests with another
+	// method always go to the origin (their response can still purge entries, see PurgeHeader).
+	// When nil, only GET and HEAD are cached.
+	CacheableMethods []string
+	// MaxBodyBytes is the maximum body size of a stored response, the larger responses (e.g. a download) are
+	// passed through without being stored. Disabled when zero.
+	MaxBodyBytes int64
+	// MaxBufferedBytes is the budget of the response bodies buffered at the same time to be stored (the bodies
+	// are read in memory to be dumped, or by BodyPolicyFunc and TTLBySize). The responses that don't fit are
+	// passed through without being stored, see Stats. Disabled when zero.
+	MaxBufferedBytes int64
+	budget           bufferBudget
+	// TTLBySize scales the lifetime of the stored responses by their size, see TTLBySizeFunc for the details.
+	TTLBySize TTLBySizeFunc
+	// ServeFreshnessFloor is the minimum remaining freshness of a served entry,
+	// the entries expiring sooner than that are refetched.
+	ServeFreshnessFloor time.Duration
+	// MaxStaleServe caps how long an entry is served once expired, whatever allows it (stale-while-revalidate,
+	// stale-if-error, the max-stale of the request, or the OfflineURLs). Past it the entry is a miss, fetched
+	// again from the origin. Disabled when zero.
+	MaxStaleServe time.Duration
+	// StalePolicies are the stale windows of the stored responses by status code, e.g. {404: {}} never serves a
+	// stale 404. They override the stale-while-revalidate and stale-if-error directives of the response.
+	StalePolicies map[int]StalePolicy
+	// StaleErrorCodes are the origin status codes replaced by a stale-if-error response, e.g. {429: true, 503: true}.
+	// When nil, those are 500, 502, 503 and 504.
+	StaleErrorCodes map[int]bool
+	// RefreshAhead is the remaining freshness under which a served entry is refetched in the background, so the
+	// hot entries are renewed before they expire. A single refresh runs per key at a time, the hits during it
+	// are served without waiting for it or starting another one. Disabled when zero.
+	RefreshAhead time.Duration
+	// RefreshAheadJitter is the fraction (e.g. 0.5) of RefreshAhead by which the window of each stored response is
+	// randomly narrowed, from the Rand source, so the entries stored together aren't refreshed at the same hit.
+	// Disabled when zero.
+	RefreshAheadJitter float64
+	// MaxBackgroundRevalidations caps the revalidations running in the background at the same time (for
+	// stale-while-revalidate and RefreshAhead), so a burst of stale hits can't start a goroutine per key. The hits
+	// beyond it are served without refreshing, they are counted in the Stats. Unbounded when zero.
+	MaxBackgroundRevalidations int
+	// CloseTimeout is how long Close waits for the running background revalidations to complete, before canceling
+	// them. They are canceled right away when zero.
+	CloseTimeout time.Duration
+	// PurgeHeader is the response header the origin uses to invalidate entries as a side effect of a request,
+	// e.g. `X-Purge: /products/123` on a mutation response. Disabled when empty.
+	PurgeHeader string
+	// HostAliases maps the equivalent hosts to the canonical one used in the cache key, so they share their
+	// entries, e.g. {"api.internal": "api", "10.0.0.5": "api"}. The hosts are lower-case, an alias with a port only
+	// applies to that port, an alias without a port to every port.
+	HostAliases map[string]string
+	// NormalizeKey will build the cache key from the normalized request URL, so the equivalent URLs share their
+	// entries: a lower-case scheme and host without its default port, "/" for an empty path, and the query
+	// parameters sorted by name. Disabled by default, the key is the URL as it is.
+	NormalizeKey bool
+	// TenantFunc will isolate the entries per tenant, the tenant it returns is part of every cache key.
+	// The requests without a tenant (an empty string) bypass the cache.
+	TenantFunc TenantFunc
+	// KeepIdenticalEntries will keep the stored response (and its validators) when a refetched response has
+	// the same body, only its freshness is renewed. This avoids churn from origins regenerating the ETag or Date
+	// of an unchanged content, but the headers of the refetched response are discarded.
+	KeepIdenticalEntries bool
+	// VerifyOnStore will read back every dumped response before storing it, and skip the ones that don't
+	// replay with the same body length. It costs a parse of each stored response.
+	VerifyOnStore bool
+	// StreamCoalescing will let the concurrent requests missing the same key follow the first one,
+	// instead of fetching the origin themselves. The followers read the body while the first request
+	// downloads it to the cache, so they progress at the pace the first caller reads its body, and get
+	// an error if it closes the body early. It allows large downloads to be fetched only once. Only a response
+	// that would be stored is streamed, to the requests of its variant.
+	StreamCoalescing bool
+	streams          streamGroup
+	// RequestCoalescing will let the concurrent requests missing the same key wait for the first one, instead of
+	// fetching the origin themselves. They all get the response once its whole body is read, so unlike the
+	// StreamCoalescing nothing is streamed, and a failure of the first request (e.g. its cancelation) is
+	// returned to all of them.
+	RequestCoalescing bool
+	flights           singleflight.Group
+	// revalidations are the keys revalidated in the background (stale-while-revalidate and RefreshAhead)
+	revalidations backgroundGroup
+	// AuthorizationKeying decide whether the Authorization header is part of the cache key,
+	// AuthorizationRoutes can override it for specific routes, the first matching route wins.
+	AuthorizationKeying AuthorizationKeying
+	AuthorizationRoutes []AuthorizationRoute
+	// DisableHTTP10Caching will never store the HTTP/1.0 responses. When false, they are cached
+	// conservatively: the freshness is never guessed from their Last-Modified header.
+	DisableHTTP10Caching bool
+	// ContentLocationKeying will also store a response under the URL of its Content-Location header,
+	// so the GET requests to that URL are served from it. It's opt-in since it trusts the origin to
+	// return the same representation on both URLs, only a Content-Location of the request origin is used.
+	ContentLocationKeying bool
+	// HitPolicyFunc is consulted on every cache hit to serve, refetch or bypass the stored response.
+	// When nil, the fresh responses are served. See HitPolicyFunc for the details.
+	HitPolicyFunc HitPolicyFunc
+	// BypassQueryParam is a query parameter bypassing the cache (no read, no store) for the requests having it,
+	// e.g. `?nocache=1` for debugging. With BypassQueryValues, only those values (case-insensitive) bypass it.
+	// Disabled when empty.
+	BypassQueryParam  string
+	BypassQueryValues []string
+	// ServerTiming will add a Server-Timing header to the responses with the duration of the cache lookup and
+	// of the origin fetch, e.g. `Server-Timing: cache-lookup;dur=0.512, origin;dur=120.250`.
+	// It's off by default, since it exposes the internal timings to the clients.
+	ServerTiming bool
+	// HeadRevalidation will probe the origin with a HEAD request when a stored response without validator
+	// (ETag or Last-Modified) expires. When the Content-Length, ETag and Last-Modified of the probe match the
+	// stored ones, the stored response is served and renewed with the freshness of the probe, instead of
+	// refetching its body. It trusts the Content-Length to detect a changed body.
+	HeadRevalidation bool
+	// CheckContentType will treat a stored response as a miss when its Content-Type is not accepted by the
+	// Accept header of the request, e.g. an origin misconfiguration storing HTML for a JSON client.
+	CheckContentType bool
+	// OfflineURLs are the path.Match patterns (e.g. "/app/*") of the requests always served from a stored response,
+	// even a stale one, e.g. the app shell of a kiosk. The origin is only fetched when nothing is stored.
+	OfflineURLs []string
+	// StatsPatterns are the path.Match patterns (e.g. "/prices/*") whose hits and misses are counted,
+	// see Stats. A request is counted for its first matching pattern, the others are not counted.
+	StatsPatterns []string
+	stats         statsRecorder
+	// CompactHeaders will store the responses without their Date header, restored from the cached time
+	// on replay, and without the headers equal to the HeaderBaseline, restored from it on replay.
+	// The baseline must not change while its compacted entries are stored.
+	CompactHeaders bool
+	HeaderBaseline http.Header
+	// Compression will compress the stored responses with the CompressionCodec, e.g. to reduce the memory of the
+	// text responses. The entries are flagged with their codec, so the entries compressed with any codec (or not
+	// compressed) are all read whatever the Compression, e.g. while migrating from gzip to brotli.
+	Compression bool
+	// CompressionCodec is the algorithm of the Compression, CodecGzip when empty.
+	CompressionCodec string
+	// CompressibleTypes are the Content-Type of the responses the Compression applies to: a media type, a prefix
+	// ending with a slash (e.g. "text/") or a suffix starting with a plus (e.g. "+json"). The responses already
+	// encoded (a Content-Encoding other than identity) and the tiny ones are always stored raw. A default list
+	// of the text types is used when nil.
+	CompressibleTypes []string
 }
 
-// NewCacheHandlerRoundtrip will create an implementations of cache http roundtripper
+// NewCacheHandlerRoundtrip will create an implementations of cache http roundtripper,
+// the same as New with WithTransport and WithRFCCompliance.
 func NewCacheHandlerRoundtrip(defaultRoundTripper http.RoundTripper, rfcCompliance bool, cacheActor cache.ICacheInteractor) *CacheHandler {
-	if cacheActor == nil {
-		log.Fatal("cache storage is not well set")
-	}
-	return &CacheHandler{
-		DefaultRoundTripper: defaultRoundTripper,
-		CacheInteractor:     cacheActor,
-		ComplyRFC:           rfcCompliance,
-	}
+	return New(cacheActor, WithTransport(defaultRoundTripper), WithRFCCompliance(rfcCompliance))
 }
 
-func validateTheCacheControl(req *http.Request, resp *http.Response) (validationResult cacheControl.ObjectResults, err error) {
+// validateTheCacheControl will evaluate the response at the given time, i.e. the time it's received or stored
+func (r *CacheHandler) validateTheCacheControl(req *http.Request, resp *http.Response, now time.Time) (validationResult cacheControl.ObjectResults, err error) {
 	reqDir, err := cacheControl.ParseRequestCacheControl(req.Header.Get("Cache-Control"))
 	if err != nil {
 		return
@@ -53,25 +254,19 @@ func validateTheCacheControl(req *http.Request, resp *http.Response) (validation
 		return
 	}
 
-	expiry := resp.Header.Get("Expires")
-	expiresHeader, err := http.ParseTime(expiry)
-	if err != nil && expiry != "" &&
-		// https://stackoverflow.com/questions/11357430/http-expires-header-values-0-and-1
-		expiry != "-1" && expiry != "0" {
-		return
-	}
-
-	dateHeaderStr := resp.Header.Get("Date")
-	dateHeader, err := http.ParseTime(dateHeaderStr)
-	if err != nil && dateHeaderStr != "" {
-		return
-	}
+	// an invalid Date is treated as absent, the time the response is received is used instead
+	dateHeader, _ := http.ParseTime(resp.Header.Get("Date"))
+	expiresHeader := parseExpires(resp.Header, dateHeader, now)
 
 	lastModifiedStr := resp.Header.Get("Last-Modified")
 	lastModifiedHeader, err := http.ParseTime(lastModifiedStr)
 	if err != nil && lastModifiedStr != "" {
 		return
 	}
+	if isHTTP10(resp) {
+		// HTTP/1.0 has no heuristic freshness, only the Expires header makes the response fresh
+		lastModifiedHeader = time.Time{}
+	}
 
 	obj := cacheControl.Object{
 		RespDirectives:         resDir,
@@ -83,7 +278,8 @@ func validateTheCacheControl(req *http.Request, resp *http.Response) (validation
 		ReqDirectives:          reqDir,
 		ReqHeaders:             req.Header,
 		ReqMethod:              req.Method,
-		NowUTC:                 time.Now().UTC(),
+		NowUTC:                 now.UTC(),
+		CacheIsPrivate:         !r.Shared,
 	}
 
 	validationResult = cacheControl.ObjectResults{}
@@ -93,77 +289,256 @@ func validateTheCacheControl(req *http.Request, resp *http.Response) (validation
 	return validationResult, nil
 }
 
-func (r *CacheHandler) roundTripRFCCompliance(req *http.Request) (resp *http.Response, err error) {
-	allowCache := allowedFromCache(req.Header)
-	if allowCache {
-		cachedResp, cachedItem, cachedErr := getCachedResponse(r.CacheInteractor, req)
-		if cachedResp != nil && cachedErr == nil {
-			buildTheCachedResponseHeader(cachedResp, cachedItem, r.CacheInteractor.Origin())
-			return cachedResp, cachedErr
+func isHTTP10(resp *http.Response) bool {
+	return resp.ProtoMajor == 1 && resp.ProtoMinor == 0
+}
+
+// parseExpires will return the Expires header of the response. An invalid one (e.g. "0" or "-1") means already
+// expired, so it's the Date of the response (or now without it), https://tools.ietf.org/html/rfc7234#section-5.3.
+// It's zero without the header.
+func parseExpires(header http.Header, date, now time.Time) time.Time {
+	expiry := header.Get("Expires")
+	if expiry == "" {
+		return time.Time{}
+	}
+	if expires, err := http.ParseTime(expiry); err == nil {
+		return expires
+	}
+	if !date.IsZero() {
+		return date
+	}
+	return now.UTC()
+}
+
+// validateStorable will check the response can be stored according to RFC 7234. The NegativeCache status
+// codes are stored even when they are not cacheable by default, the other reasons still apply.
+func (r *CacheHandler) validateStorable(req *http.Request, resp *http.Response) error {
+	validationResult, err := r.validateTheCacheControl(req, resp, r.now())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotCacheable, err)
+	}
+
+	if validationResult.OutErr != nil {
+		return fmt.Errorf("%w: %v", ErrNotCacheable, validationResult.OutErr)
+	}
+
+	// reasons to not to cache
+	reasons := validationResult.OutReasons
+	if _, negative := r.negativeTTL(req, resp); negative {
+		reasons = withoutReason(reasons, cacheControl.ReasonResponseUncachableByDefault)
+	}
+	if len(reasons) > 0 {
+		return fmt.Errorf("%w: %v", ErrNotCacheable, reasons)
+	}
+	return nil
+}
+
+// withoutReason will return the reasons to not cache without the reason
+func withoutReason(reasons []cacheControl.Reason, reason cacheControl.Reason) []cacheControl.Reason {
+	kept := make([]cacheControl.Reason, 0, len(reasons))
+	for _, r := range reasons {
+		if r != reason {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// lookupCache will return the stored response to serve, or nil with the action to take instead.
+// When the stored response can't be served but can be revalidated, it's returned as the stale entry.
+func (r *CacheHandler) lookupCache(key string, req *http.Request,
+	timing *serverTiming) (resp *http.Response, action HitAction, stale *staleEntry) {
+	defer func() {
+		r.recordLookup(req, resp != nil)
+		if resp != nil {
+			r.observer().OnHit(key)
+		} else {
+			r.observer().OnMiss(key)
+		}
+	}()
+	start := time.Now()
+	cachedResp, cachedItem, cachedErr := r.getCachedResponse(key, req)
+	var fromGet bool
+	if errors.Is(cachedErr, ErrCacheMiss) {
+		// a HEAD request can be answered by the GET entry, only when it's served as it is
+		if headResp, headItem, ok := r.headFromGet(req); ok {
+			cachedResp, cachedItem, cachedErr, fromGet = headResp, headItem, nil, true
 		}
-		// if error when getting from cachce, ignore it, re-try a live version
-		if cachedErr != nil {
-			log.Println(cachedErr, "failed to retrieve from cache, trying with a live version")
+	}
+	timing.measure("cache-lookup", start)
+	if cachedResp != nil && errors.Is(cachedErr, ErrExpired) && r.isOffline(req) {
+		cachedErr = nil
+	}
+	var revalidating bool
+	if cachedResp != nil && errors.Is(cachedErr, ErrExpired) && r.inStaleWhileRevalidate(cachedResp, cachedItem, r.now()) {
+		cachedErr, revalidating = nil, true
+	}
+	if r.HeadRevalidation && cachedResp != nil && errors.Is(cachedErr, ErrExpired) {
+		if renewed, ok := r.revalidateWithHead(key, req, cachedResp, cachedItem); ok {
+			cachedItem, cachedErr = renewed, nil
 		}
 	}
+	if cachedResp != nil && errors.Is(cachedErr, ErrExpired) {
+		if stale = revalidatable(req, cachedResp, cachedItem); stale != nil {
+			return nil, HitActionRevalidate, stale
+		}
+		cachedResp.Body.Close()
+	}
+	// if error when getting from cachce, ignore it, re-try a live version
+	if cachedErr != nil {
+		if errors.Is(cachedErr, ErrBackend) {
+			r.observer().OnError(key, cachedErr)
+		}
+		r.logger().Printf("%v failed to retrieve from cache, trying with a live version\n", cachedErr)
+		return nil, HitActionRevalidate, nil
+	}
+	if cachedResp == nil {
+		return nil, HitActionRevalidate, nil
+	}
 
-	resp, err = r.DefaultRoundTripper.RoundTrip(req)
-	if err != nil {
-		return
+	if r.CheckContentType && !acceptsContentType(req.Header.Get("Accept"), cachedResp.Header.Get("Content-Type")) {
+		r.logger().Printf("The stored Content-Type %q is not accepted, trying with a live version\n", cachedResp.Header.Get("Content-Type"))
+		cachedResp.Body.Close()
+		return nil, HitActionRevalidate, nil
+	}
+	hit := r.hitAction(req, cachedItem)
+	if hit == HitActionRevalidate && !fromGet {
+		if stale = revalidatable(req, cachedResp, cachedItem); stale != nil {
+			return nil, hit, stale
+		}
+	}
+	if hit != HitActionServe {
+		cachedResp.Body.Close()
+		return nil, hit, nil
 	}
+	if revalidating {
+		serveStale(cachedResp, cacheControl.WarningResponseIsStale, r.now())
+		r.revalidateInBackground(key, req)
+	} else if r.isStale(cachedItem, r.now()) {
+		// served anyway, e.g. within the max-stale of the request or for the OfflineURLs
+		serveStale(cachedResp, cacheControl.WarningResponseIsStale, r.now())
+	} else if !fromGet && r.inRefreshAhead(cachedItem) {
+		r.revalidateInBackground(key, req)
+	}
+	r.buildTheCachedResponseHeader(cachedResp, cachedItem, r.now())
+	return cachedResp, HitActionServe, nil
+}
 
-	validationResult, errValidation := validateTheCacheControl(req, resp)
-	if errValidation != nil {
-		log.Printf("Can't validate the response to RFC 7234, plase check. Err: %v\n", errValidation)
-		return // return directly, not sure can be stored or not
+func (r *CacheHandler) roundTripRFCCompliance(req *http.Request, timing *serverTiming) (resp *http.Response, err error) {
+	key := r.cacheKey(req)
+	allowCache := allowedFromCache(req.Header) && !isForceReload(req)
+	var stale *staleEntry
+	if allowCache {
+		cachedResp, action, staleResp := r.lookupCache(key, req, timing)
+		if cachedResp != nil {
+			return cachedResp, nil
+		}
+		if action == HitActionBypass {
+			return r.fetchOrigin(req, timing)
+		}
+		stale = staleResp
 	}
 
-	if validationResult.OutErr != nil {
-		log.Printf("Can't validate the response to RFC 7234, plase check. Err: %v\n", validationResult.OutErr)
-		return // return directly, not sure can be stored or not
+	return r.coalesce(key, req, func() (*http.Response, error) {
+		return r.fetchAndStore(key, req, stale, timing)
+	})
+}
+
+// fetchAndStore will fetch the origin (or follow the stream of the key) and store the response
+func (r *CacheHandler) fetchAndStore(key string, req *http.Request, stale *staleEntry,
+	timing *serverTiming) (resp *http.Response, err error) {
+	stream, followed := r.joinStream(key, req)
+	if followed != nil {
+		return followed, nil
 	}
+	defer stream.release()
 
-	// reasons to not to cache
-	if len(validationResult.OutReasons) > 0 {
-		log.Printf("Can't validate the response to RFC 7234, plase check. Err: %v\n", validationResult.OutReasons)
-		return // return directly, not sure can be stored or not.
+	var revalidated bool
+	resp, revalidated, err = r.fetch(key, req, stale, timing)
+	if fallback, ok := r.staleIfError(key, req, resp, err); ok {
+		return fallback, nil
 	}
+	if err != nil || revalidated {
+		return
+	}
+	r.purgeFromResponse(req, resp)
 
-	err = storeRespToCache(r.CacheInteractor, req, resp)
-	if err != nil {
-		log.Printf("Can't store the response to database, plase check. Err: %v\n", err)
-		err = nil // set err back to nil to make the call still success.
+	if r.ComplyRFC {
+		if errStorable := r.validateStorable(req, resp); errStorable != nil {
+			r.logger().Printf("Can't validate the response to RFC 7234, plase check. Err: %v\n", errStorable)
+			return // return directly, not sure can be stored or not
+		}
 	}
 
+	r.storeOrShare(stream, req, resp)
 	return
 }
 
 // RoundTrip the implementation of http.RoundTripper
 func (r *CacheHandler) RoundTrip(req *http.Request) (resp *http.Response, err error) {
-	if r.ComplyRFC {
-		return r.roundTripRFCCompliance(req)
+	if !hasAbsoluteURL(req) {
+		r.logger().Printf("Can't build the cache key of a malformed request URL, bypassing the cache. URL: %v\n", req.URL)
+		return r.DefaultRoundTripper.RoundTrip(req)
 	}
-	cachedResp, cachedItem, cachedErr := getCachedResponse(r.CacheInteractor, req)
-	if cachedResp != nil && cachedErr == nil {
-		buildTheCachedResponseHeader(cachedResp, cachedItem, r.CacheInteractor.Origin())
-		return cachedResp, cachedErr
+	if r.TenantFunc != nil && r.TenantFunc(req.Context()) == "" {
+		// fail safe, an unknown tenant must never read or write another tenant entries
+		return r.DefaultRoundTripper.RoundTrip(req)
 	}
-	// if error when getting from cachce, ignore it, re-try a live version
-	if cachedErr != nil {
-		log.Println(cachedErr, "failed to retrieve from cache, trying with a live version")
+	if r.hasBypassQuery(req) {
+		return r.DefaultRoundTripper.RoundTrip(req)
 	}
-
-	resp, err = r.DefaultRoundTripper.RoundTrip(req)
-	if err != nil {
+	if !r.isCacheableMethod(req) {
+		resp, err = r.DefaultRoundTripper.RoundTrip(req)
+		if err == nil {
+			r.purgeFromResponse(req, resp)
+		}
 		return
 	}
+	timing := r.newServerTiming()
+	// added once the response is stored
+	defer func() { timing.write(resp) }()
+	if r.ComplyRFC {
+		return r.roundTripRFCCompliance(req, timing)
+	}
+	key := r.cacheKey(req)
+	var stale *staleEntry
+	if !isForceReload(req) {
+		cachedResp, action, staleResp := r.lookupCache(key, req, timing)
+		if cachedResp != nil {
+			return cachedResp, nil
+		}
+		if action == HitActionBypass {
+			return r.fetchOrigin(req, timing)
+		}
+		stale = staleResp
+	}
 
-	err = storeRespToCache(r.CacheInteractor, req, resp)
-	if err != nil {
-		log.Printf("Can't store the response to database, plase check. Err: %v\n", err)
-		err = nil // set err back to nil to make the call still success.
+	return r.coalesce(key, req, func() (*http.Response, error) {
+		return r.fetchAndStore(key, req, stale, timing)
+	})
+}
+
+// Ping will check the connectivity of the cache storage, e.g. for a readiness check before serving traffic.
+// It's a no-op when the storage doesn't implement cache.IPinger.
+func (r *CacheHandler) Ping(ctx context.Context) error {
+	pinger, ok := r.CacheInteractor.(cache.IPinger)
+	if !ok {
+		return nil
 	}
-	return
+	return pinger.Ping(ctx)
+}
+
+// Close will stop the handler once it's discarded, the handler must not be used afterwards. In order:
+// no background revalidation starts anymore, the running ones are given the CloseTimeout to complete (and be
+// stored) before they are canceled, and once they all returned the cache storage releases its resources
+// (e.g. its connections), when it implements cache.ICloser.
+func (r *CacheHandler) Close() error {
+	r.revalidations.close(r.CloseTimeout)
+	closer, ok := r.CacheInteractor.(cache.ICloser)
+	if !ok {
+		return nil
+	}
+	return closer.Close()
 }
 
 // RFC7234Compliance used for enable/disable the RFC 7234 compliance
@@ -172,71 +547,396 @@ func (r *CacheHandler) RFC7234Compliance(val bool) *CacheHandler {
 	return r
 }
 
-func storeRespToCache(cacheInteractor cache.ICacheInteractor, req *http.Request, resp *http.Response) (err error) {
+// storeResponse will save the response to the cache storage, a failure is only logged to keep the call success.
+func (r *CacheHandler) storeResponse(req *http.Request, resp *http.Response) {
+	if !r.storable(req, resp) {
+		return
+	}
+	negativeTTL, negative := r.negativeTTL(req, resp)
+	if !r.withinBodyLimit(resp) {
+		r.logger().Printf("The response body is larger than %d bytes, skipping the storage\n", r.MaxBodyBytes)
+		return
+	}
+	release, ok := r.reserveBuffer(resp)
+	if !ok {
+		r.logger().Printf("The response body doesn't fit in the %d buffered bytes, skipping the storage\n", r.MaxBufferedBytes)
+		return
+	}
+	defer release()
+	var ttl time.Duration
+	if r.BodyPolicyFunc != nil {
+		store, bodyTTL, err := r.applyBodyPolicy(req, resp)
+		if err != nil {
+			r.logger().Printf("Can't read the response body for the body policy, plase check. Err: %v\n", err)
+			return
+		}
+		if !store {
+			return
+		}
+		ttl = bodyTTL
+	}
+	if negative {
+		ttl = negativeTTL
+	}
+	if ctxTTL := contextTTL(req); ctxTTL > 0 {
+		ttl = ctxTTL
+	}
+	if ttl == 0 && !hasCacheabilityInfo(resp.Header) {
+		if r.DefaultTTL <= 0 {
+			return // it would never be fresh, and it can't be revalidated
+		}
+		ttl = r.DefaultTTL
+	}
+	if r.TTLBySize != nil {
+		scaledTTL, err := r.scaleTTLBySize(req, resp, ttl)
+		if err != nil {
+			r.logger().Printf("Can't read the response body for the size-based TTL, plase check. Err: %v\n", err)
+			return
+		}
+		ttl = scaledTTL
+	}
+	ttl = r.clampTTL(req, resp, ttl)
+
+	key := r.cacheKey(req)
+	err := r.storeRespToCache(key, req, resp, ttl)
+	if err != nil {
+		r.observer().OnError(key, err)
+		r.logger().Printf("Can't store the response to database, plase check. Err: %v\n", err)
+	}
+}
+
+// storable will check from its headers if the response to the request can be stored, so it can answer the other
+// requests. The size of its body is checked once it's read.
+func (r *CacheHandler) storable(req *http.Request, resp *http.Response) bool {
+	if reqDir, err := ParseRequestDirectives(req); err == nil && reqDir.NoStore {
+		return false // nothing of the response to a no-store request is stored, whatever its own headers allow
+	}
+	if r.DisableHTTP10Caching && isHTTP10(resp) {
+		return false
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		return false // it only answers the validators of the request, it has no body to replay
+	}
+	if resp.StatusCode == http.StatusPartialContent || req.Header.Get("Range") != "" {
+		return false // a part of the resource can't answer the requests of the whole one
+	}
+	if _, negative := r.negativeTTL(req, resp); r.CacheableStatusCodes != nil &&
+		!r.CacheableStatusCodes[resp.StatusCode] && !negative {
+		return false
+	}
+	if _, all := varyNames(resp.Header); all {
+		return false // `Vary: *` never matches another request
+	}
+	if !r.AllowSetCookieCaching && len(resp.Header["Set-Cookie"]) > 0 {
+		return false // the cookie of a user would be replayed to the others
+	}
+	if r.MaxHeaderBytes > 0 && headerSize(resp.Header) > r.MaxHeaderBytes {
+		r.logger().Printf("The response headers are larger than %d bytes, skipping the storage\n", r.MaxHeaderBytes)
+		return false
+	}
+	return true
+}
+
+// clampTTL will cap the lifetime of the stored response to MaxTTL, a zero ttl is the freshness from the response headers
+func (r *CacheHandler) clampTTL(req *http.Request, resp *http.Response, ttl time.Duration) time.Duration {
+	if r.MaxTTL <= 0 {
+		return ttl
+	}
+	if ttl > 0 {
+		if ttl > r.MaxTTL {
+			return r.MaxTTL
+		}
+		return ttl
+	}
+	if r.headerFreshness(req, resp) > r.MaxTTL {
+		return r.MaxTTL
+	}
+	return ttl
+}
+
+// headerFreshness will return the freshness lifetime computed from the response headers, zero when there is none
+func (r *CacheHandler) headerFreshness(req *http.Request, resp *http.Response) time.Duration {
+	now := r.now()
+	validationResult, err := r.validateTheCacheControl(req, resp, now)
+	if err != nil || validationResult.OutExpirationTime.IsZero() {
+		return 0
+	}
+	if freshness := validationResult.OutExpirationTime.Sub(now); freshness > 0 {
+		return freshness
+	}
+	return 0
+}
+
+// storeRespToCache will save the response, a positive ttl overrides the freshness from the response headers.
+func (r *CacheHandler) storeRespToCache(key string, req *http.Request, resp *http.Response, ttl time.Duration) (err error) {
+	names, _ := varyNames(resp.Header)
 	cachedResp := cache.CachedResponse{
 		RequestMethod: req.Method,
-		RequestURI:    req.RequestURI,
-		CachedTime:    time.Now(),
+		RequestURI:    req.URL.String(),
+		CachedTime:    r.now(),
+		VaryHeaders:   r.varyValues(names, r.servedLanguageRequest(req, resp)),
+	}
+	if ttl = r.jitteredTTL(req, resp, ttl); ttl > 0 {
+		cachedResp.ExpiresAt = cachedResp.CachedTime.Add(ttl)
+	}
+	if r.RefreshAhead > 0 && r.RefreshAheadJitter > 0 {
+		cachedResp.RefreshJitter = r.random()
+	}
+
+	var body []byte
+	if r.VerifyOnStore {
+		if body, err = bufferBody(resp); err != nil {
+			return
+		}
 	}
 
-	dumpedResponse, err := httputil.DumpResponse(resp, true)
+	dumpedResponse, err := r.dumpResponse(resp)
 	if err != nil {
 		return
 	}
 	cachedResp.DumpedResponse = dumpedResponse
+	// the body is read by the dump, so the trailers are known
+	cachedResp.Trailer = storedTrailer(resp.Trailer)
+
+	if r.VerifyOnStore {
+		if errReplay := verifyReplay(dumpedResponse, req, len(body)); errReplay != nil {
+			r.logger().Printf("Can't replay the dumped response, skipping the storage. Err: %v\n", errReplay)
+			return
+		}
+	}
 
-	err = cacheInteractor.Set(getCacheKey(req), cachedResp)
+	if r.KeepIdenticalEntries {
+		storedKey, ok := key, true
+		if len(cachedResp.VaryHeaders) > 0 {
+			var index cache.CachedResponse
+			if index, ok = r.varyIndex(key, cachedResp); ok {
+				variantReq, _ := r.languageAlias(req, cachedResp)
+				storedKey = r.variantKey(key, index, variantReq)
+			}
+		}
+		if ok {
+			cachedResp.DumpedResponse = r.identicalStoredResponse(storedKey, dumpedResponse)
+		}
+	}
+
+	if err = r.setEntry(key, req, cachedResp); err != nil {
+		return
+	}
+	r.observer().OnStore(key)
+
+	if locationKey := r.contentLocationKey(req, resp); locationKey != "" && locationKey != key {
+		err = r.setEntry(locationKey, req, cachedResp)
+	}
 	return
 }
 
-func getCachedResponse(cacheInteractor cache.ICacheInteractor, req *http.Request) (resp *http.Response, cachedResp cache.CachedResponse, err error) {
-	cachedResp, err = cacheInteractor.Get(getCacheKey(req))
+// storedTrailer will return the trailers having a value, nil without any
+func storedTrailer(trailer http.Header) map[string][]string {
+	var stored map[string][]string
+	for name, values := range trailer {
+		if len(values) == 0 {
+			continue // declared but not sent
+		}
+		if stored == nil {
+			stored = make(map[string][]string, len(trailer))
+		}
+		stored[name] = append([]string(nil), values...)
+	}
+	return stored
+}
+
+// storageTTL will return the lifetime of the entry in the storage, i.e. its remaining freshness. The entries
+// still useful once expired (revalidated with a conditional request or a HEAD probe), or already stale,
+// are left to the expiration of the storage.
+func (r *CacheHandler) storageTTL(entry cache.CachedResponse) time.Duration {
+	if isVaryIndex(entry) {
+		return 0 // it must outlive its variants
+	}
+	if entryURL, err := url.Parse(entry.RequestURI); err == nil && r.isOffline(&http.Request{URL: entryURL}) {
+		return 0 // still served once stale
+	}
+	dumped, err := dumpedResponse(entry)
 	if err != nil {
+		return 0
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(dumped)), nil)
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+	if hasValidator(resp.Header) || (r.HeadRevalidation && resp.Header.Get("Content-Length") != "") {
+		return 0
+	}
+	expiresAt := r.storedExpiration(entry)
+	if expiresAt.IsZero() {
+		return 0
+	}
+	// served during its stale-while-revalidate or stale-if-error window
+	if ttl := expiresAt.Add(r.capStale(r.staleWindow(resp))).Sub(r.now()); ttl > 0 {
+		return ttl
+	}
+	return 0
+}
+
+func (r *CacheHandler) getCachedResponse(key string, req *http.Request) (resp *http.Response, cachedResp cache.CachedResponse, err error) {
+	cachedResp, err = r.CacheInteractor.Get(key)
+	variantReq := req
+	if err == nil && isVaryIndex(cachedResp) {
+		index := cachedResp
+		variantKey := r.variantKey(key, index, req)
+		cachedResp, err = r.CacheInteractor.Get(variantKey)
+		if err == nil && isVaryIndex(cachedResp) {
+			// the language served to the Accept-Language of the request, see ContentLanguageKeying
+			variantReq = withAcceptLanguage(req, strings.Join(cachedResp.VaryHeaders[headerAcceptLanguage], ","))
+			variantKey = r.variantKey(key, index, variantReq)
+			cachedResp, err = r.CacheInteractor.Get(variantKey)
+		}
+		key = variantKey
+	}
+	if errors.Is(err, cache.ErrInvalidCachedResponse) {
+		// e.g. a truncated file that the storage can't decode
+		err = r.dropCorrupted(key, err)
+		return
+	}
+	if err != nil {
+		err = storageError(err)
+		return
+	}
+	// the storage (e.g. in memory) can return the stored values, the response must not share them
+	cachedResp = cloneEntry(cachedResp)
+	if !r.matchVary(cachedResp, variantReq) {
+		err = fmt.Errorf("%w: the request doesn't match the Vary headers of the stored response", ErrCacheMiss)
+		return
+	}
+	if cachedResp, err = decompressEntry(cachedResp); err != nil {
+		err = r.dropCorrupted(key, err)
 		return
 	}
 
 	cachedResponse := bytes.NewBuffer(cachedResp.DumpedResponse)
 	resp, err = http.ReadResponse(bufio.NewReader(cachedResponse), req)
 	if err != nil {
+		err = r.dropCorrupted(key, err)
 		return
 	}
+	// the hop-by-hop headers are stripped on store, but an entry stored otherwise (e.g. imported) can have them
+	resp.Header, resp.Close = withoutHopByHop(resp.Header), false
+	if len(cachedResp.Trailer) > 0 {
+		resp.Trailer = http.Header(cachedResp.Trailer).Clone()
+	}
+	r.expandHeader(resp.Header, cachedResp)
 
-	validationResult, err := validateTheCacheControl(req, resp)
+	// the freshness counts from the time it's stored, not from the time it's read
+	validationResult, err := r.validateTheCacheControl(req, resp, cachedResp.CachedTime)
 	if err != nil {
 		return
 	}
 
 	if validationResult.OutErr != nil {
+		err = validationResult.OutErr
+		return
+	}
+
+	expiresAt := validationResult.OutExpirationTime
+	if !cachedResp.ExpiresAt.IsZero() {
+		expiresAt = cachedResp.ExpiresAt
+	}
+	now := r.now()
+	if r.MaxStaleServe > 0 && now.After(expiresAt.Add(r.MaxStaleServe)) {
+		err = fmt.Errorf("%w: it's staler than the MaxStaleServe", ErrCacheMiss)
+		return
+	}
+	if err = checkFreshness(req, resp, cachedResp, expiresAt, now); err != nil {
 		return
 	}
 
-	if time.Now().After(validationResult.OutExpirationTime) {
-		err = fmt.Errorf("cached-item already expired")
+	if r.ServeFreshnessFloor > 0 && now.Add(r.ServeFreshnessFloor).After(expiresAt) {
+		err = fmt.Errorf("%w: it expires within the serve freshness floor", ErrExpired)
 		return
 	}
 
 	return
 }
 
-func getCacheKey(req *http.Request) (key string) {
-	key = fmt.Sprintf("%s %s", req.Method, req.RequestURI)
-	if (strings.ToLower(req.Header.Get(HeaderCacheControl)) == "private") &&
-		req.Header.Get(HeaderAuthorization) != "" {
-		key = fmt.Sprintf("%s %s", key, req.Header.Get(HeaderAuthorization))
+// cloneEntry will return a copy of the entry that doesn't share its bytes and maps with it
+func cloneEntry(entry cache.CachedResponse) cache.CachedResponse {
+	entry.DumpedResponse = append([]byte(nil), entry.DumpedResponse...)
+	if entry.VaryHeaders != nil {
+		entry.VaryHeaders = http.Header(entry.VaryHeaders).Clone()
 	}
-	return
+	if entry.Trailer != nil {
+		entry.Trailer = http.Header(entry.Trailer).Clone()
+	}
+	return entry
+}
+
+// dropCorrupted will delete a stored response that can't be read (e.g. a truncated write), so it's replaced
+// by the live version instead of failing every lookup until it expires
+func (r *CacheHandler) dropCorrupted(key string, err error) error {
+	if delErr := r.CacheInteractor.Delete(key); delErr != nil {
+		r.logger().Printf("%v failed to delete the corrupted cached response\n", storageError(delErr))
+	}
+	return fmt.Errorf("%w: the stored response is corrupted: %v", ErrCacheMiss, err)
 }
 
 // buildTheCachedResponse will finalize the response header
-func buildTheCachedResponseHeader(resp *http.Response, cachedResp cache.CachedResponse, origin string) {
-	resp.Header.Add("Expires", cachedResp.CachedTime.String())
-	resp.Header.Add(XFromHache, "true")
-	resp.Header.Add(XHacheOrigin, origin)
+func (r *CacheHandler) buildTheCachedResponseHeader(resp *http.Response, cachedResp cache.CachedResponse, now time.Time) {
+	resp.Header.Set(HeaderAge, strconv.FormatInt(int64(currentAge(resp.Header, cachedResp, now)/time.Second), 10))
+	resp.Header.Set(r.HeaderNames.fromCache(), XFromHacheValue)
+	resp.Header.Add(r.HeaderNames.origin(), r.CacheInteractor.Origin())
+	if r.Name != "" {
+		resp.Header.Set(r.HeaderNames.name(), r.Name)
+	}
 	// TODO: (bxcodec) add more headers related to cache
 }
 
+// FromCache will check if the response is served from the cache, rather than live from the origin.
+// It checks the default header name, see CacheHandler.FromCache for a handler with its own HeaderNames.
+func FromCache(resp *http.Response) bool {
+	return (&CacheHandler{}).FromCache(resp)
+}
+
+// FromCache will check if the response is served from the cache by a handler with these HeaderNames
+func (r *CacheHandler) FromCache(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	for _, value := range resp.Header[http.CanonicalHeaderKey(r.HeaderNames.fromCache())] {
+		if strings.EqualFold(strings.TrimSpace(value), XFromHacheValue) {
+			return true
+		}
+	}
+	return false
+}
+
+// currentAge will return the age of the stored response, https://tools.ietf.org/html/rfc7234#section-4.2.3
+// It's the time it has been stored, plus the Age it had when it was received (e.g. from an upstream cache).
+func currentAge(header http.Header, cachedResp cache.CachedResponse, now time.Time) time.Duration {
+	age := now.Sub(cachedResp.CachedTime)
+	if age < 0 {
+		age = 0
+	}
+	if initialAge, err := strconv.ParseInt(header.Get(HeaderAge), 10, 64); err == nil && initialAge > 0 {
+		age += time.Duration(initialAge) * time.Second
+	}
+	return age
+}
+
+// allowedFromCache will check if the request allows a stored response to be served, i.e. it has neither
+// no-cache nor no-store in its Cache-Control
 func allowedFromCache(header http.Header) (ok bool) {
 	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Cache-Control#Cacheability
-	return !strings.Contains(strings.ToLower(header.Get(HeaderCacheControl)), "no-cache") ||
-		!strings.Contains(strings.ToLower(header.Get(HeaderCacheControl)), "no-store")
+	for _, value := range header[HeaderCacheControl] {
+		for _, directive := range strings.Split(value, ",") {
+			name := strings.TrimSpace(directive)
+			if i := strings.IndexByte(name, '='); i >= 0 {
+				name = strings.TrimSpace(name[:i])
+			}
+			name = strings.ToLower(name)
+			if name == "no-cache" || name == "no-store" {
+				return false
+			}
+		}
+	}
+	return true
 }
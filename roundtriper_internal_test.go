@@ -0,0 +1,71 @@
+package httpcache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowedFromCache(t *testing.T) {
+	tests := []struct {
+		cacheControl []string
+		expected     bool
+	}{
+		{cacheControl: nil, expected: true},
+		{cacheControl: []string{""}, expected: true},
+		{cacheControl: []string{"max-age=60"}, expected: true},
+		{cacheControl: []string{"no-cache"}, expected: false},
+		{cacheControl: []string{"no-store"}, expected: false},
+		{cacheControl: []string{"no-cache, no-store"}, expected: false},
+		{cacheControl: []string{"  No-Cache  "}, expected: false},
+		{cacheControl: []string{"max-age=0,NO-STORE"}, expected: false},
+		{cacheControl: []string{"max-age=60", "no-cache"}, expected: false},
+		// only the whole directive names count
+		{cacheControl: []string{"x-no-cache-please"}, expected: true},
+		{cacheControl: []string{`community="no-store"`}, expected: true},
+	}
+	for _, test := range tests {
+		header := http.Header{}
+		for _, value := range test.cacheControl {
+			header.Add(HeaderCacheControl, value)
+		}
+		require.Equal(t, test.expected, allowedFromCache(header), test.cacheControl)
+	}
+}
+
+func TestValidateTheCacheControlDates(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	date := now.Add(-time.Minute)
+	tests := []struct {
+		name      string
+		header    http.Header
+		expiresAt time.Time
+	}{
+		{name: "Expires: 0", expiresAt: now, header: http.Header{
+			"Expires": {"0"}, "Date": {date.Format(http.TimeFormat)},
+			"Last-Modified": {now.Add(-time.Hour).Format(http.TimeFormat)}}},
+		{name: "Expires: -1", expiresAt: now, header: http.Header{
+			"Expires": {"-1"}, "Date": {date.Format(http.TimeFormat)}}},
+		{name: "Expires: garbage", expiresAt: now, header: http.Header{"Expires": {"garbage"}}},
+		{name: "valid Expires", expiresAt: now.Add(time.Hour), header: http.Header{
+			"Expires": {date.Add(time.Hour).Format(http.TimeFormat)}, "Date": {date.Format(http.TimeFormat)}}},
+		{name: "missing Date", expiresAt: now.Add(time.Minute), header: http.Header{
+			HeaderCacheControl: {"max-age=60"}}},
+		{name: "malformed Date", expiresAt: now.Add(time.Hour), header: http.Header{
+			"Expires": {now.Add(time.Hour).Format(http.TimeFormat)}, "Date": {"yesterday"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			require.NoError(t, err)
+			resp := &http.Response{StatusCode: http.StatusOK, Header: test.header, ProtoMajor: 1, ProtoMinor: 1}
+
+			result, err := (&CacheHandler{}).validateTheCacheControl(req, resp, now)
+			require.NoError(t, err)
+			require.NoError(t, result.OutErr)
+			require.Equal(t, test.expiresAt, result.OutExpirationTime)
+		})
+	}
+}
@@ -1,15 +1,31 @@
 package httpcache_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis"
+	"github.com/bxcodec/gotcha"
+	inmemcache "github.com/bxcodec/gotcha/cache"
 	"github.com/bxcodec/httpcache"
 	"github.com/bxcodec/httpcache/cache"
+	"github.com/bxcodec/httpcache/cache/disk"
+	"github.com/bxcodec/httpcache/cache/inmem"
+	"github.com/bxcodec/httpcache/cache/noop"
+	rediscache "github.com/bxcodec/httpcache/cache/redis"
 	"github.com/bxcodec/httpcache/mocks"
+	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
@@ -18,7 +34,7 @@ func TestSetToCacheRoundtrip(t *testing.T) {
 	mockCacheInteractor := new(mocks.ICacheInteractor)
 	cachedResponse := cache.CachedResponse{}
 	mockCacheInteractor.On("Get", mock.AnythingOfType("string")).Once().Return(cachedResponse, errors.New("uknown error"))
-	mockCacheInteractor.On("Set", mock.AnythingOfType("string"), mock.Anything).Once().Return(nil)
+	mockCacheInteractor.On("Set", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Once().Return(nil)
 	client := &http.Client{}
 	client.Transport = httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, mockCacheInteractor)
 	// HTTP GET 200
@@ -45,3 +61,745 @@ func TestSetToCacheRoundtrip(t *testing.T) {
 	require.Empty(t, resp.Header.Get(httpcache.XHacheOrigin))
 	mockCacheInteractor.AssertExpectations(t)
 }
+
+func newInmemCache() cache.ICacheInteractor {
+	return inmem.NewCache(gotcha.New(
+		gotcha.NewOption().SetAlgorithm(inmemcache.LRUAlgorithm).SetMaxSizeItem(100),
+	))
+}
+
+// newCountingServer will start a server that replies with the number of hits it got so far
+func newCountingServer(t *testing.T, cacheControl string) (server *httptest.Server, hits *int64) {
+	hits = new(int64)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit := atomic.AddInt64(hits, 1)
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		w.WriteHeader(http.StatusOK)
+		_, err := fmt.Fprintf(w, "%d", hit)
+		require.NoError(t, err)
+	}))
+	return
+}
+
+func doRequest(t *testing.T, client *http.Client, req *http.Request) (resp *http.Response, body string) {
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(b)
+}
+
+func TestMaxAgeOverridesPastExpires(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Expires", time.Now().Add(time.Hour*-1).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	client := &http.Client{
+		Transport: httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache()),
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, client, req)
+	resp, _ := doRequest(t, client, req)
+
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, 1, hits)
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestPing(t *testing.T) {
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	require.NoError(t, handler.Ping(context.Background()))
+
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	c := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	handler = httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, rediscache.NewCache(context.Background(), c, time.Second*15))
+	require.NoError(t, handler.Ping(context.Background()))
+
+	// a broken storage must fail the check
+	s.Close()
+	require.Error(t, handler.Ping(context.Background()))
+
+	// storages without the capability are always reachable
+	handler = httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, new(mocks.ICacheInteractor))
+	require.NoError(t, handler.Ping(context.Background()))
+}
+
+// closingCache is a storage counting its Close calls
+type closingCache struct {
+	cache.ICacheInteractor
+	closed int
+	err    error
+}
+
+func (c *closingCache) Close() error {
+	c.closed++
+	return c.err
+}
+
+func TestClose(t *testing.T) {
+	storage := &closingCache{ICacheInteractor: newInmemCache()}
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, storage)
+	require.NoError(t, handler.Close())
+	require.Equal(t, 1, storage.closed)
+
+	storage.err = errors.New("can't close")
+	require.Equal(t, storage.err, handler.Close())
+
+	// storages without the capability have nothing to release
+	handler = httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, new(mocks.ICacheInteractor))
+	require.NoError(t, handler.Close())
+}
+
+func TestRetryingTransport(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	retrying := roundTripperFunc(func(req *http.Request) (resp *http.Response, err error) {
+		for i := 0; i < 3; i++ {
+			resp, err = http.DefaultTransport.RoundTrip(req)
+			if err == nil && resp.StatusCode < http.StatusInternalServerError {
+				return
+			}
+			if err == nil {
+				resp.Body.Close()
+			}
+		}
+		return
+	})
+
+	mockCacheInteractor := new(mocks.ICacheInteractor)
+	mockCacheInteractor.On("Get", mock.AnythingOfType("string")).Once().Return(cache.CachedResponse{}, errors.New("uknown error"))
+	mockCacheInteractor.On("Set", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Once().Return(nil)
+	handler := httpcache.NewCacheHandlerRoundtrip(retrying, true, mockCacheInteractor)
+	handler.StreamCoalescing = true
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	resp, _ := doRequest(t, &http.Client{Transport: handler}, req)
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 3, attempts)
+	// one lookup and one store for the whole logical request
+	mockCacheInteractor.AssertExpectations(t)
+}
+
+func TestServeFreshnessFloor(t *testing.T) {
+	server, hits := newCountingServer(t, "")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.DefaultTTL = time.Second * 30
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	_, body := doRequest(t, client, req)
+	require.Equal(t, "1", body)
+
+	// the entry has less than the floor left
+	handler.ServeFreshnessFloor = time.Minute
+	resp, body := doRequest(t, client, req)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "2", body)
+	require.EqualValues(t, 2, *hits)
+}
+
+func TestHTTP10Response(t *testing.T) {
+	newHTTP10Origin := func(header http.Header, hits *int) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			*hits++
+			return &http.Response{
+				Status:     "200 OK",
+				StatusCode: http.StatusOK,
+				Proto:      "HTTP/1.0",
+				ProtoMajor: 1,
+				ProtoMinor: 0,
+				Header:     header.Clone(),
+				Body:       ioutil.NopCloser(strings.NewReader("hello")),
+				Request:    req,
+			}, nil
+		})
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/hello", nil)
+	require.NoError(t, err)
+
+	t.Run("no-heuristic-freshness", func(t *testing.T) {
+		hits := 0
+		header := http.Header{}
+		header.Set("Last-Modified", time.Now().Add(-time.Hour*24*30).UTC().Format(http.TimeFormat))
+		client := &http.Client{Transport: httpcache.NewCacheHandlerRoundtrip(newHTTP10Origin(header, &hits), true, newInmemCache())}
+
+		doRequest(t, client, req)
+		resp, _ := doRequest(t, client, req)
+		require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+		require.Equal(t, 2, hits)
+	})
+
+	t.Run("expires", func(t *testing.T) {
+		hits := 0
+		header := http.Header{}
+		header.Set("Expires", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		client := &http.Client{Transport: httpcache.NewCacheHandlerRoundtrip(newHTTP10Origin(header, &hits), true, newInmemCache())}
+
+		doRequest(t, client, req)
+		resp, body := doRequest(t, client, req)
+		require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+		require.Equal(t, "hello", body)
+		require.Equal(t, 1, hits)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		hits := 0
+		header := http.Header{}
+		header.Set("Expires", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		handler := httpcache.NewCacheHandlerRoundtrip(newHTTP10Origin(header, &hits), true, newInmemCache())
+		handler.DisableHTTP10Caching = true
+		client := &http.Client{Transport: handler}
+
+		doRequest(t, client, req)
+		resp, _ := doRequest(t, client, req)
+		require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+		require.Equal(t, 2, hits)
+	})
+}
+
+func TestBypassQueryParam(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.BypassQueryParam = "nocache"
+	handler.BypassQueryValues = []string{"1", "true"}
+	client := &http.Client{Transport: handler}
+
+	bypass, err := http.NewRequest(http.MethodGet, server.URL+"?nocache=1", nil)
+	require.NoError(t, err)
+	_, body := doRequest(t, client, bypass)
+	require.Equal(t, "1", body)
+	// not stored either
+	require.Empty(t, listDebugEntries(t, httpcache.DebugHandler(handler)))
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"?nocache=0", nil)
+	require.NoError(t, err)
+	doRequest(t, client, req)
+	resp, body := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "2", body)
+
+	// not read
+	resp, body = doRequest(t, client, bypass)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "3", body)
+	require.EqualValues(t, 3, *hits)
+}
+
+func TestRequestNoCache(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	client := &http.Client{
+		Transport: httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache()),
+	}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, client, req)
+
+	noCache, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	noCache.Header.Set("Cache-Control", "No-Cache")
+	resp, body := doRequest(t, client, noCache)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "2", body)
+	require.EqualValues(t, 2, *hits)
+}
+
+func TestStorageTTL(t *testing.T) {
+	server, _ := newCountingServer(t, "max-age=60")
+	defer server.Close()
+	etagServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer etagServer.Close()
+
+	mockCacheInteractor := new(mocks.ICacheInteractor)
+	mockCacheInteractor.On("Get", mock.AnythingOfType("string")).Return(cache.CachedResponse{}, cache.ErrCacheMissed)
+	// the storage expires it with its freshness
+	mockCacheInteractor.On("Set", httpcache.SHA256KeyHash([]byte("GET "+server.URL)), mock.Anything, mock.MatchedBy(func(ttl time.Duration) bool {
+		return ttl > time.Second*59 && ttl <= time.Minute
+	})).Once().Return(nil)
+	// kept after its freshness, to be revalidated
+	mockCacheInteractor.On("Set", httpcache.SHA256KeyHash([]byte("GET "+etagServer.URL)), mock.Anything, time.Duration(0)).Once().Return(nil)
+	client := &http.Client{
+		Transport: httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, mockCacheInteractor),
+	}
+
+	for _, target := range []string{server.URL, etagServer.URL} {
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		require.NoError(t, err)
+		doRequest(t, client, req)
+	}
+	mockCacheInteractor.AssertExpectations(t)
+}
+
+func TestAgeHeader(t *testing.T) {
+	server, _ := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	client := &http.Client{
+		Transport: httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache()),
+	}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	resp, _ := doRequest(t, client, req)
+	require.Empty(t, resp.Header.Get(httpcache.HeaderAge))
+
+	resp, _ = doRequest(t, client, req)
+	require.Equal(t, "0", resp.Header.Get(httpcache.HeaderAge))
+	// the stored time is no longer written as a malformed Expires
+	require.Empty(t, resp.Header.Get("Expires"))
+
+	time.Sleep(time.Millisecond * 1100)
+	resp, _ = doRequest(t, client, req)
+	require.Equal(t, "1", resp.Header.Get(httpcache.HeaderAge))
+}
+
+func TestAgeHeaderIncludesInitialAge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// from an upstream cache
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Age", "30")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	client := &http.Client{
+		Transport: httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache()),
+	}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	resp, _ := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, []string{"30"}, resp.Header[httpcache.HeaderAge])
+}
+
+func TestOfflineURLs(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=1")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.OfflineURLs = []string{"/app/*"}
+	client := &http.Client{Transport: handler}
+
+	shell, err := http.NewRequest(http.MethodGet, server.URL+"/app/shell.js", nil)
+	require.NoError(t, err)
+	other, err := http.NewRequest(http.MethodGet, server.URL+"/prices", nil)
+	require.NoError(t, err)
+	doRequest(t, client, shell)
+	doRequest(t, client, other)
+	require.EqualValues(t, 2, *hits)
+	time.Sleep(time.Millisecond * 1100)
+
+	// stale, but still served
+	resp, body := doRequest(t, client, shell)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "1", body)
+	require.EqualValues(t, 2, *hits)
+
+	resp, body = doRequest(t, client, other)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "3", body)
+
+	// fetched on a hard miss
+	missing, err := http.NewRequest(http.MethodGet, server.URL+"/app/missing.js", nil)
+	require.NoError(t, err)
+	_, body = doRequest(t, client, missing)
+	require.Equal(t, "4", body)
+}
+
+func TestCacheableStatusCodes(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Cache-Control", "max-age=3600")
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.CacheableStatusCodes = map[int]bool{http.StatusOK: true, http.StatusMovedPermanently: true}
+	client := &http.Client{
+		Transport: handler,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	redirect, err := http.NewRequest(http.MethodGet, server.URL+"/old", nil)
+	require.NoError(t, err)
+	doRequest(t, client, redirect)
+	resp, _ := doRequest(t, client, redirect)
+	require.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+	require.Equal(t, "/new", resp.Header.Get("Location"))
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, 1, hits)
+
+	// not listed, so not stored
+	notFound, err := http.NewRequest(http.MethodGet, server.URL+"/missing", nil)
+	require.NoError(t, err)
+	doRequest(t, client, notFound)
+	resp, _ = doRequest(t, client, notFound)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, 3, hits)
+}
+
+func TestCacheableMethods(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, false, newInmemCache())
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+	require.NoError(t, err)
+
+	// never cached by default
+	doRequest(t, client, req)
+	resp, body := doRequest(t, client, req)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "2", body)
+	require.Empty(t, listDebugEntries(t, httpcache.DebugHandler(handler)))
+
+	handler.CacheableMethods = []string{http.MethodGet, http.MethodPost}
+	doRequest(t, client, req)
+	resp, body = doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "3", body)
+	require.EqualValues(t, 3, *hits)
+}
+
+func TestRequestMaxAge(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	client := &http.Client{Transport: httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, client, req)
+
+	// too old for the client, refetched and stored
+	req.Header.Set("Cache-Control", "max-age=0")
+	resp, body := doRequest(t, client, req)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "2", body)
+
+	req.Header.Del("Cache-Control")
+	resp, body = doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "2", body)
+	require.EqualValues(t, 2, *hits)
+}
+
+func TestMustRevalidateNeverServedStale(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		cacheControl string
+		served       bool
+	}{
+		{"without must-revalidate", "max-age=60, stale-if-error=3600", true},
+		{"must-revalidate", "max-age=60, stale-if-error=3600, must-revalidate", false},
+		{"proxy-revalidate", "max-age=60, stale-if-error=3600, proxy-revalidate", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var failing int32
+			server := newFailingServer(t, tc.cacheControl, &failing, http.StatusServiceUnavailable)
+			defer server.Close()
+			clock := &fakeClock{now: time.Now()}
+			handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+			handler.Clock = clock.Now
+			client := &http.Client{Transport: handler}
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			require.NoError(t, err)
+			doRequest(t, client, req)
+			clock.Advance(2 * time.Minute)
+			atomic.StoreInt32(&failing, 1)
+
+			// with a generous max-stale, and with the stale-if-error of the failing origin
+			for _, reqControl := range []string{"max-stale=3600", ""} {
+				req.Header.Set("Cache-Control", reqControl)
+				resp, _ := doRequest(t, client, req)
+				require.Equal(t, tc.served, resp.Header.Get(httpcache.XFromHache) == "true", reqControl)
+				if !tc.served {
+					require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+				}
+			}
+		})
+	}
+}
+
+func TestFromCache(t *testing.T) {
+	server, _ := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	client := &http.Client{Transport: httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	live, _ := doRequest(t, client, req)
+	require.False(t, httpcache.FromCache(live))
+	require.Empty(t, live.Header.Get(httpcache.XFromHache))
+
+	cached, _ := doRequest(t, client, req)
+	require.True(t, httpcache.FromCache(cached))
+	require.Equal(t, []string{httpcache.XFromHacheValue}, cached.Header[http.CanonicalHeaderKey(httpcache.XFromHache)])
+
+	require.False(t, httpcache.FromCache(nil))
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set(httpcache.XFromHache, " TRUE ")
+	require.True(t, httpcache.FromCache(resp))
+	resp.Header.Set(httpcache.XFromHache, "false")
+	require.False(t, httpcache.FromCache(resp))
+}
+
+func TestSharedCache(t *testing.T) {
+	hits := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "private, max-age=3600")
+		} else {
+			w.Header().Set("Cache-Control", "max-age=60, s-maxage=3600")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name          string
+		shared        bool
+		privateStored bool
+		sMaxAgeFresh  bool
+	}{
+		{"shared", true, false, true},
+		{"private", false, true, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hits = map[string]int{}
+			clock := &fakeClock{now: time.Now()}
+			handler := httpcache.New(newInmemCache(), httpcache.WithShared(tc.shared), httpcache.WithClock(clock.Now))
+			client := &http.Client{Transport: handler}
+
+			private, err := http.NewRequest(http.MethodGet, server.URL+"/private", nil)
+			require.NoError(t, err)
+			doRequest(t, client, private)
+			resp, _ := doRequest(t, client, private)
+			require.Equal(t, tc.privateStored, httpcache.FromCache(resp))
+
+			// past the max-age, within the s-maxage
+			sMaxAge, err := http.NewRequest(http.MethodGet, server.URL+"/s-maxage", nil)
+			require.NoError(t, err)
+			doRequest(t, client, sMaxAge)
+			clock.Advance(2 * time.Minute)
+			resp, _ = doRequest(t, client, sMaxAge)
+			require.Equal(t, tc.sMaxAgeFresh, httpcache.FromCache(resp))
+		})
+	}
+}
+
+func TestName(t *testing.T) {
+	server, _ := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	client := &http.Client{Transport: httpcache.New(newInmemCache(), httpcache.WithName("products"))}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	resp, _ := doRequest(t, client, req)
+	require.Empty(t, resp.Header.Get(httpcache.XHacheOrigin))
+	require.Empty(t, resp.Header.Get(httpcache.XHacheName))
+
+	resp, _ = doRequest(t, client, req)
+	require.Equal(t, cache.CacheStorageInMemory, resp.Header.Get(httpcache.XHacheOrigin))
+	require.Equal(t, "products", resp.Header.Get(httpcache.XHacheName))
+}
+
+func TestInvalidExpiresIsStale(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		// without Expires, the Last-Modified would give a heuristic freshness
+		w.Header().Set("Expires", "0")
+		w.Header().Set("Last-Modified", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	resp, _ := doRequest(t, client, req)
+	require.False(t, httpcache.FromCache(resp))
+	require.Equal(t, 2, hits)
+}
+
+func TestHeaderNames(t *testing.T) {
+	server, _ := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	handler := httpcache.New(newInmemCache(), httpcache.WithName("products"), httpcache.WithHeaderNames(httpcache.HeaderNames{
+		FromCache: "X-Acme-Cache",
+		Origin:    "X-Acme-Cache-Storage",
+	}))
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	resp, _ := doRequest(t, client, req)
+	require.False(t, handler.FromCache(resp))
+
+	resp, _ = doRequest(t, client, req)
+	require.True(t, handler.FromCache(resp))
+	require.Equal(t, httpcache.XFromHacheValue, resp.Header.Get("X-Acme-Cache"))
+	require.Equal(t, cache.CacheStorageInMemory, resp.Header.Get("X-Acme-Cache-Storage"))
+	// the names not overridden keep their default
+	require.Equal(t, "products", resp.Header.Get(httpcache.XHacheName))
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Empty(t, resp.Header.Get(httpcache.XHacheOrigin))
+	require.False(t, httpcache.FromCache(resp))
+}
+
+func TestNoopCache(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	client := &http.Client{Transport: httpcache.New(noop.NewCache())}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	for i := 1; i <= 3; i++ {
+		resp, body := doRequest(t, client, req)
+		require.False(t, httpcache.FromCache(resp))
+		require.Equal(t, fmt.Sprint(i), body)
+	}
+	require.EqualValues(t, 3, atomic.LoadInt64(hits))
+}
+
+func TestCorruptedEntryReplaced(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	cacheObj := newInmemCache()
+	client := &http.Client{Transport: httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, cacheObj)}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, client, req)
+
+	// e.g. a truncated write of the storage
+	keys, err := cacheObj.(cache.IKeyLister).Keys()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.NoError(t, cacheObj.Set(keys[0], cache.CachedResponse{
+		DumpedResponse: []byte("HTTP/1.1 2"),
+		RequestURI:     server.URL,
+		CachedTime:     time.Now(),
+	}, time.Hour))
+
+	resp, body := doRequest(t, client, req)
+	require.False(t, httpcache.FromCache(resp))
+	require.Equal(t, "2", body)
+
+	resp, body = doRequest(t, client, req)
+	require.True(t, httpcache.FromCache(resp))
+	require.Equal(t, "2", body)
+	require.EqualValues(t, 2, atomic.LoadInt64(hits))
+}
+
+func TestCorruptedDiskEntryReplaced(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "httpcache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	client := &http.Client{Transport: httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, disk.NewCache(dir))}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, client, req)
+
+	// e.g. a truncated write of the file
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.NoError(t, ioutil.WriteFile(files[0], []byte(`{"key":"`), 0600))
+
+	resp, body := doRequest(t, client, req)
+	require.False(t, httpcache.FromCache(resp))
+	require.Equal(t, "2", body)
+
+	resp, body = doRequest(t, client, req)
+	require.True(t, httpcache.FromCache(resp))
+	require.Equal(t, "2", body)
+	require.EqualValues(t, 2, atomic.LoadInt64(hits))
+
+	// dropped, even when the live version can't replace it
+	require.NoError(t, ioutil.WriteFile(files[0], []byte(`{"key":"`), 0600))
+	server.Close()
+	_, err = client.Do(req)
+	require.Error(t, err)
+	_, err = os.Stat(files[0])
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestCachedResponsesIndependent(t *testing.T) {
+	server, _ := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	client := &http.Client{Transport: httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, client, req)
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 20)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var resp *http.Response
+			resp, bodies[i] = doRequest(t, client, req)
+			require.True(t, httpcache.FromCache(resp))
+			resp.Header.Set("Cache-Control", "no-store")
+			resp.Header["Content-Length"][0] = "0"
+			resp.Header.Add("X-Reader", fmt.Sprint(i))
+		}(i)
+	}
+	wg.Wait()
+	for _, body := range bodies {
+		require.Equal(t, "1", body)
+	}
+
+	// the stored response is unaffected
+	resp, body := doRequest(t, client, req)
+	require.True(t, httpcache.FromCache(resp))
+	require.Equal(t, "max-age=3600", resp.Header.Get("Cache-Control"))
+	require.Equal(t, "1", resp.Header.Get("Content-Length"))
+	require.Empty(t, resp.Header.Get("X-Reader"))
+	require.Equal(t, "1", body)
+}
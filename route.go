@@ -0,0 +1,65 @@
+package httpcache
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// matchRoute will report whether the request path matches the path.Match pattern
+func matchRoute(pattern string, req *http.Request) bool {
+	if req.URL == nil {
+		return false
+	}
+	matched, err := path.Match(pattern, req.URL.Path)
+	return err == nil && matched
+}
+
+// isOffline will check if the request matches one of the OfflineURLs
+func (r *CacheHandler) isOffline(req *http.Request) bool {
+	for _, pattern := range r.OfflineURLs {
+		if matchRoute(pattern, req) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultCacheableMethods are the cached request methods when CacheableMethods is nil
+var defaultCacheableMethods = []string{http.MethodGet, http.MethodHead}
+
+// isCacheableMethod will check if the request method is one of the CacheableMethods
+func (r *CacheHandler) isCacheableMethod(req *http.Request) bool {
+	methods := r.CacheableMethods
+	if methods == nil {
+		methods = defaultCacheableMethods
+	}
+	for _, method := range methods {
+		if req.Method == method {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBypassQuery will report whether the request has the BypassQueryParam with one of the BypassQueryValues
+func (r *CacheHandler) hasBypassQuery(req *http.Request) bool {
+	if r.BypassQueryParam == "" {
+		return false
+	}
+	values, ok := req.URL.Query()[r.BypassQueryParam]
+	if !ok {
+		return false
+	}
+	if len(r.BypassQueryValues) == 0 {
+		return true
+	}
+	for _, value := range values {
+		for _, truthy := range r.BypassQueryValues {
+			if strings.EqualFold(value, truthy) {
+				return true
+			}
+		}
+	}
+	return false
+}
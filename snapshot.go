@@ -0,0 +1,64 @@
+package httpcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/bxcodec/httpcache/cache"
+)
+
+// snapshotEntry is a line of the snapshot written by Export
+type snapshotEntry struct {
+	Key   string               `json:"key"`
+	Entry cache.CachedResponse `json:"entry"`
+}
+
+// Export will write all the stored entries with their metadata to w, one JSON object per line.
+// It requires the storage to implement cache.IKeyLister.
+func (r *CacheHandler) Export(w io.Writer) error {
+	lister, ok := r.CacheInteractor.(cache.IKeyLister)
+	if !ok {
+		return ErrKeysNotListable
+	}
+	keys, err := lister.Keys()
+	if err != nil {
+		return storageError(err)
+	}
+
+	encoder := json.NewEncoder(w)
+	for _, key := range keys {
+		item, err := r.CacheInteractor.Get(key)
+		if err != nil {
+			// the item might be expired or deleted after listing the keys
+			continue
+		}
+		if err := encoder.Encode(snapshotEntry{Key: key, Entry: item}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import will store the entries of a snapshot written by Export, the entries already expired are skipped.
+// Every store goes through the storage Set, so it's meant for the boot, before serving the traffic.
+func (r *CacheHandler) Import(rd io.Reader) error {
+	decoder := json.NewDecoder(rd)
+	now := r.now()
+	for {
+		var entry snapshotEntry
+		err := decoder.Decode(&entry)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("can't decode the snapshot: %w", err)
+		}
+		if !r.storedExpiration(entry.Entry).After(now) {
+			continue
+		}
+		if err := r.CacheInteractor.Set(entry.Key, entry.Entry, r.storageTTL(entry.Entry)); err != nil {
+			return storageError(err)
+		}
+	}
+}
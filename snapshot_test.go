@@ -0,0 +1,46 @@
+package httpcache_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/bxcodec/httpcache/cache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	source := newInmemCache()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, source)
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, &http.Client{Transport: handler}, req)
+
+	expired := cache.CachedResponse{
+		DumpedResponse: []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"),
+		RequestURI:     "/expired",
+		RequestMethod:  http.MethodGet,
+		CachedTime:     time.Now().Add(-time.Hour),
+		ExpiresAt:      time.Now().Add(-time.Minute),
+	}
+	require.NoError(t, source.Set("expired", expired, 0))
+
+	var snapshot bytes.Buffer
+	require.NoError(t, handler.Export(&snapshot))
+
+	target := newInmemCache()
+	warmed := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, target)
+	require.NoError(t, warmed.Import(&snapshot))
+
+	_, err = target.Get("expired")
+	require.Equal(t, cache.ErrCacheMissed, err)
+
+	resp, body := doRequest(t, &http.Client{Transport: warmed}, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "1", body)
+	require.EqualValues(t, 1, *hits)
+}
@@ -0,0 +1,164 @@
+package httpcache
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/bxcodec/httpcache/cache"
+	cacheControl "github.com/bxcodec/httpcache/helper/cacheheader"
+)
+
+// StalePolicy are the windows a stored response is served for once expired, see StalePolicies
+type StalePolicy struct {
+	// WhileRevalidate is served while the response is revalidated in the background, like stale-while-revalidate
+	WhileRevalidate time.Duration
+	// IfError replaces the origin failures, like stale-if-error
+	IfError time.Duration
+}
+
+// staleWindows will return the stale-while-revalidate and stale-if-error windows of the response,
+// https://tools.ietf.org/html/rfc5861. Those are zero without the directives, or with must-revalidate
+// (or proxy-revalidate). The StalePolicies of its status code override them.
+func (r *CacheHandler) staleWindows(resp *http.Response) (whileRevalidate, ifError time.Duration) {
+	if policy, ok := r.StalePolicies[resp.StatusCode]; ok {
+		return policy.WhileRevalidate, policy.IfError
+	}
+	dir, err := cacheControl.ParseResponseCacheControl(resp.Header.Get(HeaderCacheControl))
+	if err != nil || dir.MustRevalidate || dir.ProxyRevalidate {
+		return 0, 0
+	}
+	if dir.StaleWhileRevalidate > 0 {
+		whileRevalidate = time.Duration(dir.StaleWhileRevalidate) * time.Second
+	}
+	if dir.StaleIfError > 0 {
+		ifError = time.Duration(dir.StaleIfError) * time.Second
+	}
+	return
+}
+
+// staleWindow will return how long the response can be served stale, whatever the reason
+func (r *CacheHandler) staleWindow(resp *http.Response) time.Duration {
+	whileRevalidate, ifError := r.staleWindows(resp)
+	if ifError > whileRevalidate {
+		return ifError
+	}
+	return whileRevalidate
+}
+
+// capStale will cap the window an expired response is served for to the MaxStaleServe, the expired entries
+// past it are misses (see getCachedResponse)
+func (r *CacheHandler) capStale(window time.Duration) time.Duration {
+	if r.MaxStaleServe > 0 && window > r.MaxStaleServe {
+		return r.MaxStaleServe
+	}
+	return window
+}
+
+// withinWindow will check if the expired response is still within the window after its expiry
+func (r *CacheHandler) withinWindow(item cache.CachedResponse, window time.Duration, now time.Time) bool {
+	expiresAt := r.storedExpiration(item)
+	return window > 0 && !expiresAt.IsZero() && now.Before(expiresAt.Add(window))
+}
+
+// inStaleWhileRevalidate will check if the expired response is still within its stale-while-revalidate window
+func (r *CacheHandler) inStaleWhileRevalidate(resp *http.Response, item cache.CachedResponse, now time.Time) bool {
+	whileRevalidate, _ := r.staleWindows(resp)
+	return r.withinWindow(item, whileRevalidate, now)
+}
+
+// isStale will check if the stored response is expired at now, it's also the case without any freshness
+func (r *CacheHandler) isStale(item cache.CachedResponse, now time.Time) bool {
+	expiresAt := r.storedExpiration(item)
+	return expiresAt.IsZero() || now.After(expiresAt)
+}
+
+// serveStale will mark the response as stale with the warning, https://tools.ietf.org/html/rfc7234#section-5.5
+func serveStale(resp *http.Response, warning cacheControl.Warning, now time.Time) {
+	resp.Header.Add("Warning", warning.HeaderString("", now))
+}
+
+// isServerError will check if the origin response is an error the stale-if-error responses can replace,
+// one of the StaleErrorCodes
+func (r *CacheHandler) isServerError(resp *http.Response) bool {
+	if r.StaleErrorCodes != nil {
+		return r.StaleErrorCodes[resp.StatusCode]
+	}
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// staleIfError will return the expired stored response instead of the origin failure (a transport error or a
+// 5xx, see StaleErrorCodes), when it's within its stale-if-error window, https://tools.ietf.org/html/rfc5861#section-4.
+// The origin response is closed when it's replaced.
+func (r *CacheHandler) staleIfError(key string, req *http.Request, resp *http.Response, err error) (*http.Response, bool) {
+	if err == nil && !r.isServerError(resp) {
+		return nil, false
+	}
+	if isForceReload(req) || !allowedFromCache(req.Header) {
+		return nil, false // the client asked for a live version only
+	}
+	cachedResp, cachedItem, cachedErr := r.getCachedResponse(key, req)
+	if cachedResp == nil {
+		return nil, false
+	}
+	_, ifError := r.staleWindows(cachedResp)
+	now := r.now()
+	if !errors.Is(cachedErr, ErrExpired) || !r.withinWindow(cachedItem, ifError, now) {
+		cachedResp.Body.Close()
+		return nil, false
+	}
+	if err != nil {
+		r.logger().Printf("The origin failed, serving the stale response. Err: %v\n", err)
+	} else {
+		r.logger().Printf("The origin replied %d, serving the stale response\n", resp.StatusCode)
+		resp.Body.Close()
+	}
+	serveStale(cachedResp, cacheControl.WarningRevalidationFailed, now)
+	r.buildTheCachedResponseHeader(cachedResp, cachedItem, now)
+	return cachedResp, true
+}
+
+// revalidateInBackground will refresh the stale entry of the request (or the one within RefreshAhead) without
+// waiting for it, with a context detached from the request one (only canceled by Close). A single revalidation
+// of the key runs at a time, the hits during it are served without starting another one.
+func (r *CacheHandler) revalidateInBackground(key string, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return // the request body is already sent
+	}
+	ctx, ok := r.revalidations.start(req.Context(), key, r.MaxBackgroundRevalidations)
+	if !ok {
+		return // served without refreshing, it's revalidated by a later hit
+	}
+	bgReq := req.Clone(ctx)
+	go func() {
+		defer r.revalidations.done(key)
+		var stale *staleEntry
+		cachedResp, cachedItem, err := r.getCachedResponse(key, bgReq)
+		if cachedResp != nil {
+			if err == nil && !r.inRefreshAhead(cachedItem) {
+				// already refreshed
+				cachedResp.Body.Close()
+				return
+			}
+			if err == nil || errors.Is(err, ErrExpired) {
+				stale = revalidatable(bgReq, cachedResp, cachedItem)
+			}
+			if stale == nil {
+				cachedResp.Body.Close()
+			}
+		}
+		resp, err := r.fetchAndStore(key, bgReq, stale, nil)
+		if err != nil {
+			r.logger().Printf("Can't revalidate the stale response in the background, plase check. Err: %v\n", err)
+			return
+		}
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
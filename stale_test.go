@@ -0,0 +1,320 @@
+package httpcache_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=1, stale-while-revalidate=30")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	time.Sleep(time.Millisecond * 1100)
+
+	// the stale response is served right away
+	resp, got := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "1", got)
+	require.True(t, strings.HasPrefix(resp.Header.Get("Warning"), "110 "))
+
+	// and refreshed in the background
+	require.Eventually(t, func() bool {
+		resp, got := doRequest(t, client, req)
+		return got == "2" && resp.Header.Get("Warning") == ""
+	}, time.Second, time.Millisecond*10)
+	require.Equal(t, int64(2), atomic.LoadInt64(hits))
+}
+
+func TestMaxStaleServe(t *testing.T) {
+	var hits int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit := atomic.AddInt64(&hits, 1)
+		w.Header()["Date"] = nil
+		w.Header().Set("Cache-Control", "max-age=60, stale-while-revalidate=86400")
+		_, err := fmt.Fprintf(w, "%d", hit)
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	clock := &fakeClock{now: time.Now()}
+	handler := httpcache.New(newInmemCache(), httpcache.WithClock(clock.Now), httpcache.WithMaxStaleServe(time.Hour))
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, client, req)
+
+	// within the cap, the stale response is served and revalidated in the background
+	clock.Advance(time.Minute + 30*time.Minute)
+	resp, got := doRequest(t, client, req)
+	require.True(t, httpcache.FromCache(resp))
+	require.Equal(t, "1", got)
+	require.Eventually(t, func() bool { return atomic.LoadInt64(&hits) == 2 }, time.Second, 10*time.Millisecond)
+
+	// past it, the generous stale-while-revalidate window doesn't matter, it's a miss
+	clock.Advance(time.Minute + 2*time.Hour)
+	resp, got = doRequest(t, client, req)
+	require.False(t, httpcache.FromCache(resp))
+	require.Equal(t, "3", got)
+
+	// nor the max-stale of the request
+	clock.Advance(time.Minute + 2*time.Hour)
+	maxStale, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	maxStale.Header.Set("Cache-Control", "max-stale")
+	resp, got = doRequest(t, client, maxStale)
+	require.False(t, httpcache.FromCache(resp))
+	require.Equal(t, "4", got)
+}
+
+func TestStaleWhileRevalidateMustRevalidate(t *testing.T) {
+	server, hits := newCountingServer(t, "max-age=1, stale-while-revalidate=30, must-revalidate")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	time.Sleep(time.Millisecond * 1100)
+
+	resp, got := doRequest(t, client, req)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "2", got)
+	require.Equal(t, int64(2), atomic.LoadInt64(hits))
+}
+
+// newFailingServer will start a server that replies with the hit count, then with the status once failing is set
+func newFailingServer(t *testing.T, cacheControl string, failing *int32, status int) *httptest.Server {
+	var hits int64
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(failing) == 1 {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Cache-Control", cacheControl)
+		w.WriteHeader(http.StatusOK)
+		_, err := fmt.Fprintf(w, "%d", atomic.AddInt64(&hits, 1))
+		require.NoError(t, err)
+	}))
+}
+
+func TestStaleIfError(t *testing.T) {
+	var failing int32
+	server := newFailingServer(t, "max-age=1, stale-if-error=30", &failing, http.StatusServiceUnavailable)
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	time.Sleep(time.Millisecond * 1100)
+
+	// the origin fails, the stale response is served
+	atomic.StoreInt32(&failing, 1)
+	resp, got := doRequest(t, client, req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "1", got)
+	require.True(t, strings.HasPrefix(resp.Header.Get("Warning"), "111 "))
+
+	// the origin is back, the response is refreshed
+	atomic.StoreInt32(&failing, 0)
+	resp, got = doRequest(t, client, req)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "2", got)
+}
+
+func TestStaleIfErrorTransportError(t *testing.T) {
+	var failing int32
+	server := newFailingServer(t, "max-age=1, stale-if-error=30", &failing, http.StatusOK)
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	doRequest(t, client, req)
+	time.Sleep(time.Millisecond * 1100)
+
+	server.Close()
+	resp, got := doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "1", got)
+}
+
+func TestStaleIfErrorNotForOtherStatuses(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		cacheControl string
+		status       int
+	}{
+		{"client error", "max-age=1, stale-if-error=30", http.StatusNotFound},
+		{"not implemented", "max-age=1, stale-if-error=30", http.StatusNotImplemented},
+		{"without stale-if-error", "max-age=1", http.StatusServiceUnavailable},
+		{"must-revalidate", "max-age=1, stale-if-error=30, must-revalidate", http.StatusServiceUnavailable},
+		{"proxy-revalidate", "max-age=1, stale-if-error=30, proxy-revalidate", http.StatusServiceUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var failing int32
+			server := newFailingServer(t, tc.cacheControl, &failing, tc.status)
+			defer server.Close()
+			handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+			client := &http.Client{Transport: handler}
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			require.NoError(t, err)
+
+			doRequest(t, client, req)
+			time.Sleep(time.Millisecond * 1100)
+
+			atomic.StoreInt32(&failing, 1)
+			resp, _ := doRequest(t, client, req)
+			require.Equal(t, tc.status, resp.StatusCode)
+			require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+		})
+	}
+}
+
+func TestStalePolicies(t *testing.T) {
+	var failing int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header()["Date"] = nil
+		w.Header().Set("Cache-Control", "max-age=10, stale-if-error=60")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		_, err := w.Write([]byte(r.URL.Path))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	clock := &fakeClock{now: time.Now()}
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.Clock = clock.Now
+	handler.StalePolicies = map[int]httpcache.StalePolicy{
+		http.StatusOK:       {IfError: 5 * time.Minute},
+		http.StatusNotFound: {},
+	}
+	handler.StaleErrorCodes = map[int]bool{http.StatusTooManyRequests: true}
+	client := &http.Client{Transport: handler}
+	okReq, err := http.NewRequest(http.MethodGet, server.URL+"/ok", nil)
+	require.NoError(t, err)
+	missingReq, err := http.NewRequest(http.MethodGet, server.URL+"/missing", nil)
+	require.NoError(t, err)
+	doRequest(t, client, okReq)
+	doRequest(t, client, missingReq)
+
+	// within the stale-if-error of the directive, the stale 404 is never served
+	clock.Advance(30 * time.Second)
+	atomic.StoreInt32(&failing, 1)
+	resp, _ := doRequest(t, client, missingReq)
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+
+	// past the stale-if-error of the directive, within the one of the 200 policy
+	clock.Advance(90 * time.Second)
+	resp, got := doRequest(t, client, okReq)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "/ok", got)
+}
+
+func TestStaleWarning(t *testing.T) {
+	server, _ := newCountingServer(t, "max-age=60")
+	defer server.Close()
+	clock := &fakeClock{now: time.Now()}
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.Clock = clock.Now
+	handler.OfflineURLs = []string{"/offline"}
+	client := &http.Client{Transport: handler}
+	for _, path := range []string{"/", "/offline"} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		doRequest(t, client, req)
+
+		// fresh
+		resp, _ := doRequest(t, client, req)
+		require.True(t, httpcache.FromCache(resp))
+		require.Empty(t, resp.Header.Get("Warning"))
+	}
+
+	clock.Advance(2 * time.Minute)
+	// within the max-stale of the request
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/", nil)
+	require.NoError(t, err)
+	req.Header.Set("Cache-Control", "max-stale=3600")
+	resp, _ := doRequest(t, client, req)
+	require.True(t, httpcache.FromCache(resp))
+	require.True(t, strings.HasPrefix(resp.Header.Get("Warning"), "110 "))
+	// or of any staleness
+	req.Header.Set("Cache-Control", "max-stale")
+	resp, _ = doRequest(t, client, req)
+	require.True(t, httpcache.FromCache(resp))
+	require.True(t, strings.HasPrefix(resp.Header.Get("Warning"), "110 "))
+
+	// for an offline URL
+	req, err = http.NewRequest(http.MethodGet, server.URL+"/offline", nil)
+	require.NoError(t, err)
+	resp, _ = doRequest(t, client, req)
+	require.True(t, httpcache.FromCache(resp))
+	require.True(t, strings.HasPrefix(resp.Header.Get("Warning"), "110 "))
+}
+
+// newBlockingServer will start a server replying to the first request, the next ones wait for the release
+func newBlockingServer(t *testing.T, cacheControl string, release chan struct{}) (server *httptest.Server, hits *int64) {
+	hits = new(int64)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(hits, 1) > 1 {
+			<-release
+		}
+		// without Date, the freshness only counts on the fake clock
+		w.Header()["Date"] = nil
+		w.Header().Set("Cache-Control", cacheControl)
+		_, err := w.Write([]byte("hello"))
+		require.NoError(t, err)
+	}))
+	return
+}
+
+func TestStaleWhileRevalidateOnce(t *testing.T) {
+	release := make(chan struct{})
+	server, hits := newBlockingServer(t, "max-age=60, stale-while-revalidate=600", release)
+	defer server.Close()
+	clock := &fakeClock{now: time.Now()}
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.Clock = clock.Now
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, client, req)
+
+	clock.Advance(2 * time.Minute)
+	doRequest(t, client, req)
+	require.Eventually(t, func() bool { return atomic.LoadInt64(hits) == 2 }, time.Second, 10*time.Millisecond)
+
+	// the hits during the revalidation return without starting a goroutine
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		resp, _ := doRequest(t, client, req)
+		require.True(t, httpcache.FromCache(resp))
+	}
+	require.True(t, runtime.NumGoroutine() < goroutines+10, "%d goroutines, %d before", runtime.NumGoroutine(), goroutines)
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	require.EqualValues(t, 2, atomic.LoadInt64(hits))
+}
@@ -0,0 +1,88 @@
+package httpcache
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/bxcodec/httpcache/cache"
+)
+
+// Stats represent the cache efficiency since the handler was created, and its current buffering
+type Stats struct {
+	// Patterns are the lookups counted per StatsPatterns, keyed by pattern
+	Patterns map[string]PatternStats
+	// BufferedBytes are the response bytes currently buffered to be stored, within MaxBufferedBytes
+	BufferedBytes int64
+	// BudgetSkips are the responses not stored since they didn't fit in MaxBufferedBytes
+	BudgetSkips int64
+	// DroppedRevalidations are the background revalidations not started since MaxBackgroundRevalidations
+	// were already running
+	DroppedRevalidations int64
+	// Storage are the live statistics of the cache storage, nil when it doesn't implement cache.IStatsReporter
+	Storage *cache.Stats
+}
+
+// PatternStats are the lookups of the requests matching a StatsPatterns pattern
+type PatternStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// HitRatio will return the ratio of the lookups served from the cache, zero without lookup
+func (s PatternStats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// statsRecorder count the lookups per pattern, it's zero-value usable
+type statsRecorder struct {
+	mu       sync.Mutex
+	patterns map[string]PatternStats
+}
+
+// recordLookup will count the lookup of the request for its first matching StatsPatterns pattern
+func (r *CacheHandler) recordLookup(req *http.Request, hit bool) {
+	for _, pattern := range r.StatsPatterns {
+		if !matchRoute(pattern, req) {
+			continue
+		}
+		r.stats.mu.Lock()
+		if r.stats.patterns == nil {
+			r.stats.patterns = make(map[string]PatternStats)
+		}
+		counts := r.stats.patterns[pattern]
+		if hit {
+			counts.Hits++
+		} else {
+			counts.Misses++
+		}
+		r.stats.patterns[pattern] = counts
+		r.stats.mu.Unlock()
+		return
+	}
+}
+
+// Stats will return a snapshot of the cache efficiency and buffering. Only the lookups of the requests matching the
+// StatsPatterns are counted, the requests bypassing the cache (e.g. ForceReload) are not lookups.
+func (r *CacheHandler) Stats() Stats {
+	var storage *cache.Stats
+	if reporter, ok := r.CacheInteractor.(cache.IStatsReporter); ok {
+		reported := reporter.Stats()
+		storage = &reported
+	}
+	r.stats.mu.Lock()
+	defer r.stats.mu.Unlock()
+	stats := Stats{Patterns: make(map[string]PatternStats, len(r.stats.patterns)), Storage: storage}
+	for pattern, counts := range r.stats.patterns {
+		stats.Patterns[pattern] = counts
+	}
+	r.budget.mu.Lock()
+	stats.BufferedBytes, stats.BudgetSkips = r.budget.buffered, r.budget.skipped
+	r.budget.mu.Unlock()
+	r.revalidations.mu.Lock()
+	stats.DroppedRevalidations = r.revalidations.dropped
+	r.revalidations.mu.Unlock()
+	return stats
+}
@@ -0,0 +1,74 @@
+package httpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/bxcodec/httpcache/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsPatterns(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/search" {
+			w.Header().Set("Cache-Control", "no-store")
+		} else {
+			w.Header().Set("Cache-Control", "max-age=3600")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.StatsPatterns = []string{"/prices/*", "/search"}
+	client := &http.Client{Transport: handler}
+
+	get := func(path string) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		doRequest(t, client, req)
+	}
+	get("/search")
+	get("/search")
+	get("/prices/1")
+	get("/prices/1")
+	get("/prices/1")
+	// not a configured pattern
+	get("/other")
+
+	stats := handler.Stats()
+	require.Equal(t, map[string]httpcache.PatternStats{
+		"/prices/*": {Hits: 2, Misses: 1},
+		"/search":   {Hits: 0, Misses: 2},
+	}, stats.Patterns)
+	require.InDelta(t, 2.0/3.0, stats.Patterns["/prices/*"].HitRatio(), 0.001)
+	require.Zero(t, stats.Patterns["/search"].HitRatio())
+}
+
+func TestStorageStats(t *testing.T) {
+	server, _ := newCountingServer(t, "max-age=3600")
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	for _, path := range []string{"/a", "/b", "/c", "/a", "/b", "/a"} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		doRequest(t, client, req)
+	}
+
+	stats := handler.Stats()
+	require.NotNil(t, stats.Storage)
+	require.EqualValues(t, 3, stats.Storage.Entries)
+	require.EqualValues(t, 3, stats.Storage.Hits)
+	require.EqualValues(t, 3, stats.Storage.Misses)
+	var size int64
+	for _, entry := range listDebugEntries(t, httpcache.DebugHandler(handler)) {
+		size += int64(entry.Size)
+	}
+	require.Equal(t, size, stats.Storage.Bytes)
+
+	// storages without the capability
+	handler = httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, new(mocks.ICacheInteractor))
+	require.Nil(t, handler.Stats().Storage)
+}
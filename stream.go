@@ -0,0 +1,220 @@
+package httpcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// errStreamAborted is returned to the followers when the leader closed the body before the end of the stream
+var errStreamAborted = errors.New("the shared response stream closed before it completed")
+
+// streamGroup keep the in-flight origin fetches that concurrent requests of the same key can follow
+type streamGroup struct {
+	mu      sync.Mutex
+	streams map[string]*responseStream
+}
+
+// responseStream is an origin response being written to the cache by its leader request,
+// the followers read the same body bytes as soon as the leader reads them.
+type responseStream struct {
+	group *streamGroup
+	key   string
+	req   *http.Request // the leader one
+	ready chan struct{} // closed when the leader shared the response or gave up
+
+	// set once before ready is closed, nil when the response is not shared
+	resp *http.Response
+
+	mu      sync.Mutex
+	written chan struct{} // closed (and replaced) on every write
+	buf     []byte
+	done    bool
+	err     error
+}
+
+// joinStream will register the request as the leader of the key, or follow the in-flight leader.
+// The leader gets the stream to share its response, the follower gets the shared response.
+// Both are nil when streaming is disabled, for a Range request, or when the leader didn't share a response
+// (e.g. it isn't storable), or when it's another variant than the one of the request.
+func (r *CacheHandler) joinStream(key string, req *http.Request) (leader *responseStream, followed *http.Response) {
+	if !r.StreamCoalescing || req.Header.Get("Range") != "" {
+		return nil, nil // a partial response can't be shared
+	}
+
+	r.streams.mu.Lock()
+	stream, ok := r.streams.streams[key]
+	if !ok {
+		if r.streams.streams == nil {
+			r.streams.streams = make(map[string]*responseStream)
+		}
+		stream = &responseStream{group: &r.streams, key: key, req: req, ready: make(chan struct{}),
+			written: make(chan struct{})}
+		r.streams.streams[key] = stream
+	}
+	r.streams.mu.Unlock()
+	if !ok {
+		return stream, nil
+	}
+
+	<-stream.ready
+	if stream.resp == nil || !r.sameVariant(stream.resp.Header, stream.req, req) {
+		return nil, nil
+	}
+	return nil, stream.follow(req)
+}
+
+// storeOrShare will store the response, and share its body with the followers when leading a stream.
+// Only a response that would be stored is shared, the followers of the others fetch the origin on their own.
+func (r *CacheHandler) storeOrShare(stream *responseStream, req *http.Request, resp *http.Response) {
+	if stream == nil {
+		r.storeResponse(req, resp)
+		return
+	}
+	if !r.storable(req, resp) {
+		return
+	}
+	if r.MaxBodyBytes > 0 && (resp.ContentLength < 0 || resp.ContentLength > r.MaxBodyBytes) {
+		// its size is only known once the body is read, too late for the followers
+		r.storeResponse(req, resp)
+		return
+	}
+	stream.share(resp, func(buffered *http.Response) {
+		r.storeResponse(req, buffered)
+	})
+}
+
+// release will let the followers fetch on their own when the leader didn't share its response
+func (s *responseStream) release() {
+	if s == nil {
+		return
+	}
+	select {
+	case <-s.ready:
+	default:
+		s.leave()
+		close(s.ready)
+	}
+}
+
+func (s *responseStream) leave() {
+	s.group.mu.Lock()
+	if s.group.streams[s.key] == s {
+		delete(s.group.streams, s.key)
+	}
+	s.group.mu.Unlock()
+}
+
+func (s *responseStream) share(resp *http.Response, onComplete func(buffered *http.Response)) {
+	s.resp = &http.Response{
+		Status:        resp.Status,
+		StatusCode:    resp.StatusCode,
+		Proto:         resp.Proto,
+		ProtoMajor:    resp.ProtoMajor,
+		ProtoMinor:    resp.ProtoMinor,
+		Header:        resp.Header.Clone(),
+		ContentLength: resp.ContentLength,
+		// filled once the body is read, before the followers read its end
+		Trailer: resp.Trailer,
+	}
+	resp.Body = &streamLeaderBody{stream: s, body: resp.Body, onComplete: func(body []byte) {
+		buffered := *s.resp
+		buffered.Header = s.resp.Header.Clone()
+		buffered.Body = ioutil.NopCloser(bytes.NewReader(body))
+		onComplete(&buffered)
+	}}
+	close(s.ready)
+}
+
+func (s *responseStream) follow(req *http.Request) *http.Response {
+	resp := *s.resp
+	resp.Header = s.resp.Header.Clone()
+	resp.Body = &streamFollowerBody{stream: s, ctx: req.Context()}
+	resp.Request = req
+	return &resp
+}
+
+func (s *responseStream) write(p []byte, err error) (complete bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return false
+	}
+	s.buf = append(s.buf, p...)
+	if err != nil {
+		s.done = true
+		if err != io.EOF {
+			s.err = err
+		}
+	}
+	close(s.written)
+	s.written = make(chan struct{})
+	return s.done && s.err == nil
+}
+
+type streamLeaderBody struct {
+	stream     *responseStream
+	body       io.ReadCloser
+	onComplete func(body []byte)
+}
+
+func (b *streamLeaderBody) Read(p []byte) (n int, err error) {
+	n, err = b.body.Read(p)
+	if err == nil && n == 0 {
+		return
+	}
+	if b.stream.write(p[:n], err) {
+		// the body is complete, nothing writes to the buffer anymore
+		b.onComplete(b.stream.buf)
+	}
+	if err != nil {
+		b.stream.leave()
+	}
+	return
+}
+
+func (b *streamLeaderBody) Close() error {
+	b.stream.write(nil, errStreamAborted)
+	b.stream.leave()
+	return b.body.Close()
+}
+
+type streamFollowerBody struct {
+	stream *responseStream
+	ctx    context.Context // of the follower request, its cancelation stops the reads
+	offset int
+}
+
+func (b *streamFollowerBody) Read(p []byte) (n int, err error) {
+	s := b.stream
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for b.offset >= len(s.buf) && !s.done {
+		written := s.written
+		s.mu.Unlock()
+		select {
+		case <-written:
+		case <-b.ctx.Done():
+			s.mu.Lock()
+			return 0, b.ctx.Err()
+		}
+		s.mu.Lock()
+	}
+	if b.offset < len(s.buf) {
+		n = copy(p, s.buf[b.offset:])
+		b.offset += n
+		return
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+	return 0, io.EOF
+}
+
+func (b *streamFollowerBody) Close() error {
+	return nil
+}
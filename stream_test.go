@@ -0,0 +1,233 @@
+package httpcache_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamCoalescing(t *testing.T) {
+	var hits int64
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+	firstHalf, secondHalf := strings.Repeat("a", 4096), strings.Repeat("b", 4096)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=3600")
+		_, _ = w.Write([]byte(firstHalf))
+		w.(http.Flusher).Flush()
+		close(arrived)
+		<-release
+		_, _ = w.Write([]byte(secondHalf))
+	}))
+	defer server.Close()
+
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.StreamCoalescing = true
+	client := &http.Client{Transport: handler}
+
+	newRequest := func() *http.Request {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		return req
+	}
+	readBody := func(resp *http.Response) string {
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	leader, err := client.Do(newRequest())
+	require.NoError(t, err)
+	<-arrived
+	// the leader is still downloading, so the follower must get the response from its stream
+	follower, err := client.Do(newRequest())
+	require.NoError(t, err)
+	require.EqualValues(t, 1, atomic.LoadInt64(&hits))
+
+	var wg sync.WaitGroup
+	var leaderBody string
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		leaderBody = readBody(leader)
+	}()
+	close(release)
+	require.Equal(t, firstHalf+secondHalf, readBody(follower))
+	wg.Wait()
+	require.Equal(t, firstHalf+secondHalf, leaderBody)
+	require.EqualValues(t, 1, atomic.LoadInt64(&hits))
+
+	// the leader stored the whole body
+	resp, body := doRequest(t, client, newRequest())
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, firstHalf+secondHalf, body)
+}
+
+// newStreamingServer will reply the first half of the body, and its second half once released
+func newStreamingServer(t *testing.T, handle func(w http.ResponseWriter, r *http.Request),
+	release chan struct{}) (server *httptest.Server, hits *int64, arrived chan struct{}) {
+	hits, arrived = new(int64), make(chan struct{}, 10)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(hits, 1)
+		handle(w, r)
+		_, _ = w.Write([]byte(strings.Repeat("a", 4096)))
+		w.(http.Flusher).Flush()
+		arrived <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		_, _ = w.Write([]byte(strings.Repeat("b", 4096)))
+	}))
+	return
+}
+
+func TestStreamCoalescingShareable(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(h *httpcache.CacheHandler)
+		header    http.Header
+		shared    bool
+	}{
+		{name: "storable", header: http.Header{"Cache-Control": {"max-age=3600"}}, shared: true},
+		{
+			name:      "status not cacheable",
+			configure: func(h *httpcache.CacheHandler) { h.CacheableStatusCodes = map[int]bool{http.StatusNotFound: true} },
+			header:    http.Header{"Cache-Control": {"max-age=3600"}},
+		},
+		{name: "vary all", header: http.Header{"Cache-Control": {"max-age=3600"}, "Vary": {"*"}}},
+		{
+			name:      "larger than MaxBodyBytes",
+			configure: func(h *httpcache.CacheHandler) { h.MaxBodyBytes = 1024 },
+			header:    http.Header{"Cache-Control": {"max-age=3600"}, "Content-Length": {"8192"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			release := make(chan struct{})
+			server, hits, arrived := newStreamingServer(t, func(w http.ResponseWriter, r *http.Request) {
+				for name, values := range test.header {
+					w.Header()[name] = values
+				}
+			}, release)
+			defer server.Close()
+			defer close(release)
+			handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+			handler.StreamCoalescing = true
+			if test.configure != nil {
+				test.configure(handler)
+			}
+			client := &http.Client{Transport: handler}
+
+			leader, err := client.Get(server.URL)
+			require.NoError(t, err)
+			defer leader.Body.Close()
+			<-arrived
+			follower, err := client.Get(server.URL)
+			require.NoError(t, err)
+			defer follower.Body.Close()
+			if test.shared {
+				require.EqualValues(t, 1, atomic.LoadInt64(hits))
+			} else {
+				require.EqualValues(t, 2, atomic.LoadInt64(hits))
+			}
+		})
+	}
+}
+
+func TestStreamCoalescingVariant(t *testing.T) {
+	release := make(chan struct{})
+	server, hits, arrived := newStreamingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Header().Set("Content-Language", r.Header.Get("Accept-Language"))
+	}, release)
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.StreamCoalescing = true
+	client := &http.Client{Transport: handler}
+	newRequest := func(language string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept-Language", language)
+		return req
+	}
+
+	leader, err := client.Do(newRequest("en"))
+	require.NoError(t, err)
+	defer leader.Body.Close()
+	<-arrived
+	// the same variant follows the leader, another one fetches the origin on its own
+	same, err := client.Do(newRequest("en"))
+	require.NoError(t, err)
+	defer same.Body.Close()
+	require.EqualValues(t, 1, atomic.LoadInt64(hits))
+	require.Equal(t, "en", same.Header.Get("Content-Language"))
+	other := make(chan *http.Response)
+	go func() {
+		resp, err := client.Do(newRequest("fr"))
+		require.NoError(t, err)
+		other <- resp
+	}()
+	<-arrived
+	require.EqualValues(t, 2, atomic.LoadInt64(hits))
+	close(release)
+	resp := <-other
+	defer resp.Body.Close()
+	require.Equal(t, "fr", resp.Header.Get("Content-Language"))
+}
+
+func TestStreamFollowerCanceled(t *testing.T) {
+	release := make(chan struct{})
+	server, hits, arrived := newStreamingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+	}, release)
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.StreamCoalescing = true
+	client := &http.Client{Transport: handler}
+
+	leader, err := client.Get(server.URL)
+	require.NoError(t, err)
+	<-arrived
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	follower, err := client.Do(req)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, atomic.LoadInt64(hits))
+
+	// the follower stops waiting for the leader once its request is canceled
+	read := make(chan error)
+	go func() {
+		_, err := ioutil.ReadAll(follower.Body)
+		read <- err
+	}()
+	cancel()
+	select {
+	case err = <-read:
+		require.True(t, errors.Is(err, context.Canceled), "got %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("the follower read is still waiting for the leader")
+	}
+
+	// and the leader is unaffected
+	close(release)
+	body, err := ioutil.ReadAll(leader.Body)
+	require.NoError(t, err)
+	require.Len(t, body, 8192)
+	require.NoError(t, leader.Body.Close())
+}
@@ -0,0 +1,49 @@
+package httpcache
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HeaderServerTiming is the response header carrying the durations measured when ServerTiming is enabled
+const HeaderServerTiming = "Server-Timing"
+
+// serverTiming collect the durations of a request spans, a nil serverTiming measures nothing
+type serverTiming struct {
+	metrics []string
+}
+
+func (r *CacheHandler) newServerTiming() *serverTiming {
+	if !r.ServerTiming {
+		return nil
+	}
+	return &serverTiming{}
+}
+
+func (t *serverTiming) measure(name string, start time.Time) {
+	if t == nil {
+		return
+	}
+	// the durations are in milliseconds: https://www.w3.org/TR/server-timing/
+	t.metrics = append(t.metrics, fmt.Sprintf("%s;dur=%.3f", name, float64(time.Since(start))/float64(time.Millisecond)))
+}
+
+// write will add the metrics to the response, it must run after the response is stored to not store them
+func (t *serverTiming) write(resp *http.Response) {
+	if t == nil || resp == nil || len(t.metrics) == 0 {
+		return
+	}
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	resp.Header.Add(HeaderServerTiming, strings.Join(t.metrics, ", "))
+}
+
+// fetchOrigin will send the request to the origin and measure it
+func (r *CacheHandler) fetchOrigin(req *http.Request, timing *serverTiming) (*http.Response, error) {
+	start := time.Now()
+	defer timing.measure("origin", start)
+	return r.DefaultRoundTripper.RoundTrip(req)
+}
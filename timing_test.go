@@ -0,0 +1,59 @@
+package httpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+var serverTimingMetric = regexp.MustCompile(`([a-z-]+);dur=([0-9.]+)`)
+
+func serverTimingDurations(t *testing.T, resp *http.Response) map[string]time.Duration {
+	values := resp.Header[httpcache.HeaderServerTiming]
+	require.Len(t, values, 1)
+	durations := map[string]time.Duration{}
+	for _, match := range serverTimingMetric.FindAllStringSubmatch(values[0], -1) {
+		ms, err := strconv.ParseFloat(match[2], 64)
+		require.NoError(t, err)
+		durations[match[1]] = time.Duration(ms * float64(time.Millisecond))
+	}
+	return durations
+}
+
+func TestServerTiming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 50)
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	resp, _ := doRequest(t, client, req)
+	require.Empty(t, resp.Header.Get(httpcache.HeaderServerTiming))
+	require.NoError(t, handler.CacheInteractor.Flush())
+
+	handler.ServerTiming = true
+	resp, _ = doRequest(t, client, req)
+	durations := serverTimingDurations(t, resp)
+	require.Len(t, durations, 2)
+	require.Contains(t, durations, "cache-lookup")
+	require.GreaterOrEqual(t, int64(durations["origin"]), int64(time.Millisecond*50))
+	require.Less(t, int64(durations["cache-lookup"]), int64(durations["origin"]))
+
+	// a hit has no origin fetch, and its stored response has no timing of the miss
+	resp, _ = doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	durations = serverTimingDurations(t, resp)
+	require.Len(t, durations, 1)
+	require.Contains(t, durations, "cache-lookup")
+}
@@ -0,0 +1,65 @@
+package httpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+// trailerHandler replies with its trailers, declared in the Trailer header
+func trailerHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte("hello"))
+		require.NoError(t, err)
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set("Grpc-Message", "OK")
+	})
+}
+
+func TestTrailers(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		http2     bool
+		configure func(*httpcache.CacheHandler)
+	}{
+		{name: "chunked"},
+		{name: "http2", http2: true},
+		{name: "stream coalescing", configure: func(h *httpcache.CacheHandler) { h.StreamCoalescing = true }},
+		{name: "request coalescing", configure: func(h *httpcache.CacheHandler) { h.RequestCoalescing = true }},
+		{name: "compression", configure: func(h *httpcache.CacheHandler) { h.Compression = true }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(trailerHandler(t))
+			server.EnableHTTP2 = test.http2
+			server.StartTLS()
+			defer server.Close()
+			handler := httpcache.NewCacheHandlerRoundtrip(server.Client().Transport, true, newInmemCache())
+			if test.configure != nil {
+				test.configure(handler)
+			}
+			assertTrailers(t, &http.Client{Transport: handler}, server.URL)
+		})
+	}
+}
+
+func assertTrailers(t *testing.T, client *http.Client, url string) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+
+	resp, body := doRequest(t, client, req)
+	require.Equal(t, "hello", body)
+	require.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+
+	// the trailers are replayed once the body is read
+	resp, body = doRequest(t, client, req)
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "hello", body)
+	require.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+	require.Equal(t, "OK", resp.Trailer.Get("Grpc-Message"))
+}
@@ -0,0 +1,239 @@
+package httpcache
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/bxcodec/httpcache/cache"
+)
+
+// varyNames will return the sorted canonical header names listed in the Vary header,
+// all is true for a `Vary: *`, i.e. a response that can't be reused for another request
+func varyNames(header http.Header) (names []string, all bool) {
+	seen := map[string]bool{}
+	for _, value := range header["Vary"] {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name == "*" {
+				return nil, true
+			}
+			name = http.CanonicalHeaderKey(name)
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, false
+}
+
+// VaryNormalizerFunc will canonicalize the value of a request header listed by the Vary header (its values joined
+// with a comma), e.g. lowercase it or strip its whitespace. The requests with the same normalized values select the
+// same variant, so it must only collapse the values the origin answers with the same response.
+type VaryNormalizerFunc func(name, value string) string
+
+// varyValue will return the value of the request header listed by the Vary header, normalized by the VaryNormalizer
+func (r *CacheHandler) varyValue(name string, req *http.Request) string {
+	value := strings.Join(req.Header[name], ",")
+	if r.VaryNormalizer != nil {
+		value = r.VaryNormalizer(name, value)
+	}
+	return value
+}
+
+// varyValues will return the values of the request headers listed by the Vary header of the response
+func (r *CacheHandler) varyValues(names []string, req *http.Request) map[string][]string {
+	if len(names) == 0 {
+		return nil
+	}
+	values := make(map[string][]string, len(names))
+	for _, name := range names {
+		if r.VaryNormalizer != nil {
+			values[name] = []string{r.varyValue(name, req)}
+			continue
+		}
+		values[name] = append([]string(nil), req.Header[name]...)
+	}
+	return values
+}
+
+// headerAcceptLanguage is the request header selecting the variants by their Content-Language,
+// see ContentLanguageKeying
+const headerAcceptLanguage = "Accept-Language"
+
+// withAcceptLanguage will return a copy of the request asking for the language
+func withAcceptLanguage(req *http.Request, language string) *http.Request {
+	aliased := *req
+	aliased.Header = req.Header.Clone()
+	aliased.Header.Set(headerAcceptLanguage, language)
+	return &aliased
+}
+
+// servedLanguageRequest will return the request selecting the variant of the response by its Content-Language,
+// when it's keyed by the served language. It's the request itself otherwise.
+func (r *CacheHandler) servedLanguageRequest(req *http.Request, resp *http.Response) *http.Request {
+	if !r.ContentLanguageKeying {
+		return req
+	}
+	names, _ := varyNames(resp.Header)
+	i := sort.SearchStrings(names, headerAcceptLanguage)
+	if i == len(names) || names[i] != headerAcceptLanguage {
+		return req
+	}
+	language := strings.ToLower(strings.Replace(strings.Join(resp.Header["Content-Language"], ","), " ", "", -1))
+	if language == "" {
+		return req // keyed by the raw header
+	}
+	return withAcceptLanguage(req, language)
+}
+
+// languageAlias will return the request selecting the entry keyed by its served language, true when it's not
+// the one of the Accept-Language of the request: the variant key of the request then stores an alias to it.
+func (r *CacheHandler) languageAlias(req *http.Request, entry cache.CachedResponse) (*http.Request, bool) {
+	values, ok := entry.VaryHeaders[headerAcceptLanguage]
+	if !r.ContentLanguageKeying || !ok {
+		return req, false
+	}
+	served := strings.Join(values, ",")
+	if served == r.varyValue(headerAcceptLanguage, req) {
+		return req, false
+	}
+	return withAcceptLanguage(req, served), true
+}
+
+// isVaryIndex will check if the entry only lists the Vary header names, its variants are stored under variantKey
+func isVaryIndex(entry cache.CachedResponse) bool {
+	return len(entry.DumpedResponse) == 0 && len(entry.VaryHeaders) > 0
+}
+
+// matchVary will check if the request has the same values as the stored variant for its Vary headers
+func (r *CacheHandler) matchVary(entry cache.CachedResponse, req *http.Request) bool {
+	for name, values := range entry.VaryHeaders {
+		if strings.Join(values, ",") != r.varyValue(name, req) {
+			return false
+		}
+	}
+	return true
+}
+
+// variantKey will return the key of the variant selected by the request, in the generation of the Vary index
+func (r *CacheHandler) variantKey(key string, index cache.CachedResponse, req *http.Request) string {
+	names := make([]string, 0, len(index.VaryHeaders))
+	for name := range index.VaryHeaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	variant := fmt.Sprintf("%s %d", key, index.CachedTime.UnixNano())
+	for _, name := range names {
+		// quoted, so the values can't forge the separators
+		variant += fmt.Sprintf(" %s=%q", name, r.varyValue(name, req))
+	}
+	return r.keyHash()([]byte(variant))
+}
+
+// maxListedVariants is the number of variants listed by a Vary index, for their revalidation together
+const maxListedVariants = 8
+
+// listVariant will return the variants of the index listing the entry, the oldest ones beyond maxListedVariants
+// are dropped. It's a new slice, the index can be the stored one.
+func (r *CacheHandler) listVariant(index, entry cache.CachedResponse) []map[string][]string {
+	variants := make([]map[string][]string, 0, len(index.Variants)+1)
+	for _, values := range index.Variants {
+		if !r.matchVary(entry, variantRequest(&http.Request{}, values)) {
+			variants = append(variants, values)
+		}
+	}
+	variants = append(variants, entry.VaryHeaders)
+	if len(variants) > maxListedVariants {
+		variants = variants[len(variants)-maxListedVariants:]
+	}
+	return variants
+}
+
+// variantRequest will return a copy of the request with the values selecting a listed variant
+func variantRequest(req *http.Request, values map[string][]string) *http.Request {
+	variant := *req
+	variant.Header = req.Header.Clone()
+	if variant.Header == nil {
+		variant.Header = make(http.Header)
+	}
+	for name, value := range values {
+		variant.Header[name] = value
+		if len(value) == 0 {
+			delete(variant.Header, name)
+		}
+	}
+	return &variant
+}
+
+// varyIndex will return the Vary index stored under the key when it lists the same names as the entry
+func (r *CacheHandler) varyIndex(key string, entry cache.CachedResponse) (index cache.CachedResponse, ok bool) {
+	index, err := r.CacheInteractor.Get(key)
+	if err != nil || !isVaryIndex(index) || len(index.VaryHeaders) != len(entry.VaryHeaders) {
+		return index, false
+	}
+	for name := range entry.VaryHeaders {
+		if _, ok := index.VaryHeaders[name]; !ok {
+			return index, false
+		}
+	}
+	return index, true
+}
+
+// setEntry will store the entry under the key. A variant (an entry with VaryHeaders) is stored under its
+// variantKey, and the key only stores the Vary index listing the header names to find it. So all the
+// variants of a key are kept, and they all become unreachable when the key is deleted: the next
+// Vary index starts a new generation of variant keys.
+func (r *CacheHandler) setEntry(key string, req *http.Request, entry cache.CachedResponse) error {
+	ttl := r.storageTTL(entry)
+	stored, err := r.compressEntry(entry)
+	if err != nil {
+		return err
+	}
+	if len(entry.VaryHeaders) == 0 {
+		return storageError(r.CacheInteractor.Set(key, stored, ttl))
+	}
+	expiresAt := r.storedExpiration(entry)
+	index, ok := r.varyIndex(key, entry)
+	if !ok {
+		index = cache.CachedResponse{
+			RequestURI:    entry.RequestURI,
+			RequestMethod: entry.RequestMethod,
+			CachedTime:    r.now(),
+			VaryHeaders:   make(map[string][]string, len(entry.VaryHeaders)),
+		}
+		for name := range entry.VaryHeaders {
+			index.VaryHeaders[name] = nil
+		}
+	}
+	if index.ExpiresAt.Before(expiresAt) {
+		// lives as long as its last expiring variant
+		index.ExpiresAt = expiresAt
+	}
+	index.Variants = r.listVariant(index, entry)
+	variantReq, aliased := r.languageAlias(req, entry)
+	if err := storageError(r.CacheInteractor.Set(r.variantKey(key, index, variantReq), stored, ttl)); err != nil {
+		return err
+	}
+	if aliased {
+		// looks like a Vary index without the response, pointing to the variant of the served language
+		alias := cache.CachedResponse{
+			RequestURI:    entry.RequestURI,
+			RequestMethod: entry.RequestMethod,
+			CachedTime:    entry.CachedTime,
+			ExpiresAt:     entry.ExpiresAt,
+			VaryHeaders:   map[string][]string{headerAcceptLanguage: entry.VaryHeaders[headerAcceptLanguage]},
+		}
+		if err := storageError(r.CacheInteractor.Set(r.variantKey(key, index, req), alias, ttl)); err != nil {
+			return err
+		}
+	}
+	return storageError(r.CacheInteractor.Set(key, index, 0))
+}
@@ -0,0 +1,194 @@
+package httpcache_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bxcodec/httpcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaryAcceptEncoding(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Vary", "Accept-Encoding")
+		w.WriteHeader(http.StatusOK)
+		_, err := fmt.Fprintf(w, "%s %d", r.Header.Get("Accept-Encoding"), hits)
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	client := &http.Client{Transport: handler}
+
+	get := func(encoding string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept-Encoding", encoding)
+		return doRequest(t, client, req)
+	}
+
+	_, body := get("gzip")
+	require.Equal(t, "gzip 1", body)
+	resp, body := get("identity")
+	require.Empty(t, resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "identity 2", body)
+
+	// both variants are kept
+	resp, body = get("gzip")
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "gzip 1", body)
+	resp, body = get("identity")
+	require.Equal(t, "true", resp.Header.Get(httpcache.XFromHache))
+	require.Equal(t, "identity 2", body)
+	require.Equal(t, 2, hits)
+}
+
+func TestVaryStarNotStored(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Vary", "Accept-Encoding, *")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	doRequest(t, &http.Client{Transport: handler}, req)
+
+	require.Empty(t, listDebugEntries(t, httpcache.DebugHandler(handler)))
+}
+
+func TestVaryPurgeAllVariants(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.Method == http.MethodPost {
+			w.Header().Set("X-Purge", "/")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Vary", "Accept-Language")
+		w.WriteHeader(http.StatusOK)
+		_, err := fmt.Fprintf(w, "%d", hits)
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	handler := httpcache.NewCacheHandlerRoundtrip(http.DefaultTransport, true, newInmemCache())
+	handler.PurgeHeader = "X-Purge"
+	client := &http.Client{Transport: handler}
+
+	get := func(language string) string {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/", nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept-Language", language)
+		_, body := doRequest(t, client, req)
+		return body
+	}
+	require.Equal(t, "1", get("en"))
+	require.Equal(t, "2", get("fr"))
+
+	post, err := http.NewRequest(http.MethodPost, server.URL+"/", nil)
+	require.NoError(t, err)
+	doRequest(t, client, post)
+
+	// the purge of the URL makes every variant unreachable
+	require.Equal(t, "4", get("en"))
+	require.Equal(t, "5", get("fr"))
+}
+
+func TestVaryNormalizer(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Vary", "X-Theme")
+		w.WriteHeader(http.StatusOK)
+		_, err := fmt.Fprintf(w, "%s %d", strings.ToLower(r.Header.Get("X-Theme")), hits)
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	handler := httpcache.New(newInmemCache(), httpcache.WithVaryNormalizer(func(name, value string) string {
+		return strings.ToLower(strings.TrimSpace(value))
+	}))
+	client := &http.Client{Transport: handler}
+	get := func(theme string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Theme", theme)
+		return doRequest(t, client, req)
+	}
+
+	_, body := get("Dark")
+	require.Equal(t, "dark 1", body)
+	// the case variants select the same entry
+	for _, theme := range []string{"dark", "DARK", " dark"} {
+		resp, body := get(theme)
+		require.True(t, httpcache.FromCache(resp), theme)
+		require.Equal(t, "dark 1", body)
+	}
+	resp, body := get("light")
+	require.False(t, httpcache.FromCache(resp))
+	require.Equal(t, "light 2", body)
+	require.Equal(t, 2, hits)
+}
+
+func TestContentLanguageKeying(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		language := "fr"
+		switch accept := r.Header.Get("Accept-Language"); {
+		case strings.HasPrefix(accept, "en"):
+			language = "en"
+		case accept == "de":
+			language = "" // without Content-Language
+		}
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Vary", "Accept-Language")
+		if language != "" {
+			w.Header().Set("Content-Language", language)
+		}
+		w.WriteHeader(http.StatusOK)
+		_, err := fmt.Fprintf(w, "%s %d", language, hits)
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	handler := httpcache.New(newInmemCache())
+	handler.ContentLanguageKeying = true
+	client := &http.Client{Transport: handler}
+	get := func(language string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept-Language", language)
+		return doRequest(t, client, req)
+	}
+
+	_, body := get("en-US")
+	require.Equal(t, "en 1", body)
+	// another Accept-Language served in English replaces the same entry
+	resp, body := get("en-GB,en;q=0.8")
+	require.False(t, httpcache.FromCache(resp))
+	require.Equal(t, "en 2", body)
+	for _, language := range []string{"en-US", "en-GB,en;q=0.8", "en"} {
+		resp, body = get(language)
+		require.True(t, httpcache.FromCache(resp), language)
+		require.Equal(t, "en 2", body)
+	}
+	resp, body = get("fr-FR")
+	require.False(t, httpcache.FromCache(resp))
+	require.Equal(t, "fr 3", body)
+
+	// keyed by the raw header without Content-Language
+	_, body = get("de")
+	require.Equal(t, " 4", body)
+	resp, body = get("de")
+	require.True(t, httpcache.FromCache(resp))
+	require.Equal(t, " 4", body)
+	require.Equal(t, 4, hits)
+}